@@ -0,0 +1,120 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// auth.go authenticates the requests that HTTPPool peers send each other.
+
+package groupcache
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	timestampHeader = "X-Groupcache-Timestamp" // Unix time in seconds
+	signatureHeader = "X-Groupcache-Signature" // hex HMAC-SHA256
+)
+
+// maxSignatureAge is how far the timestamp of a signed request may be
+// from the time it is received. It bounds the window in which a
+// captured request can be replayed, and must allow for clock skew.
+const maxSignatureAge = 5 * time.Minute
+
+// signature returns the signature of a request under secret.
+func signature(secret []byte, method, uri, timestamp string, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	io.WriteString(mac, method+"\n"+uri+"\n"+timestamp+"\n")
+	mac.Write(sum[:])
+	return mac.Sum(nil)
+}
+
+// signRequest signs req, whose body is body, under secret.
+func signRequest(req *http.Request, secret, body []byte) {
+	timestamp := strconv.FormatInt(timeNow().Unix(), 10)
+	sig := signature(secret, req.Method, req.URL.RequestURI(), timestamp, body)
+	req.Header.Set(timestampHeader, timestamp)
+	req.Header.Set(signatureHeader, hex.EncodeToString(sig))
+}
+
+// verifyRequest reports whether r is recently signed under secret. It
+// reads the body of r, up to maxBodySize, and replaces it for later
+// readers.
+func verifyRequest(w http.ResponseWriter, r *http.Request, secret []byte) bool {
+	timestamp := r.Header.Get(timestampHeader)
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := timeNow().Sub(time.Unix(t, 0)); age > maxSignatureAge || age < -maxSignatureAge {
+		return false
+	}
+	sig, err := hex.DecodeString(r.Header.Get(signatureHeader))
+	if err != nil {
+		return false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		return false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return hmac.Equal(sig, signature(secret, r.Method, r.URL.RequestURI(), timestamp, body))
+}
+
+// verifyClientCert reports whether r comes over TLS with a verified
+// client certificate that is valid for the host of one of the peers.
+func (p *HTTPPool) verifyClientCert(r *http.Request) bool {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return false
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for peer := range p.httpGetters {
+		u, err := url.Parse(peer)
+		if err == nil && cert.VerifyHostname(u.Hostname()) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate reports whether r comes from a peer, as the options of
+// the pool require. Otherwise it replies with an error, counting the
+// request in the Stats of the named group.
+func (p *HTTPPool) authenticate(w http.ResponseWriter, r *http.Request, groupName string) bool {
+	code := 0
+	switch {
+	case p.opts.VerifyClientCert && !p.verifyClientCert(r):
+		code = http.StatusForbidden
+	case len(p.opts.Secret) > 0 && !verifyRequest(w, r, p.opts.Secret):
+		code = http.StatusUnauthorized
+	default:
+		return true
+	}
+	if g := p.opts.Registry.GetGroup(groupName); g != nil {
+		g.Stats.AuthRejects.Add(1)
+	}
+	http.Error(w, http.StatusText(code), code)
+	return false
+}
@@ -21,6 +21,7 @@ import (
 	"errors"
 	"io"
 	"strings"
+	"time"
 )
 
 // A ByteView holds an immutable view of bytes.
@@ -33,6 +34,25 @@ type ByteView struct {
 	// If b is non-nil, b is used, else s is used.
 	b []byte
 	s string
+
+	// If e is non-zero, the view is only valid until e.
+	e time.Time
+
+	// If codec is not nil, b holds the value encoded by codec. Such
+	// views stay within the caches and peers of a group; setSinkView
+	// decodes them.
+	codec Codec
+}
+
+// Expire returns the time at which the view's data expires, or the
+// zero Time if it never expires.
+func (v ByteView) Expire() time.Time {
+	return v.e
+}
+
+// expired reports whether the view has expired as of now.
+func (v ByteView) expired(now time.Time) bool {
+	return !v.e.IsZero() && !now.Before(v.e)
 }
 
 // Len returns the view's length.
@@ -0,0 +1,136 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// codec.go compresses values in the caches and between peers.
+
+package groupcache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// A Codec encodes the values of a group, typically to compress them.
+// A group with a Codec keeps its values encoded in its caches, decodes
+// them for its callers, and exchanges them encoded with the peers that
+// use the same Codec, which other peers learn from their requests.
+type Codec interface {
+	// Name identifies the codec to peers, for example "gzip".
+	Name() string
+
+	// Encode returns the encoding of b.
+	Encode(b []byte) ([]byte, error)
+
+	// Decode returns the bytes whose encoding is b.
+	Decode(b []byte) ([]byte, error)
+}
+
+// GzipCodec returns a Codec that compresses values with gzip at the
+// given level, such as gzip.DefaultCompression.
+func GzipCodec(level int) Codec {
+	return &gzipCodec{level: level}
+}
+
+type gzipCodec struct {
+	level   int
+	writers sync.Pool // of *gzip.Writer
+}
+
+func (c *gzipCodec) Name() string { return "gzip" }
+
+func (c *gzipCodec) Encode(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, _ := c.writers.Get().(*gzip.Writer)
+	if zw == nil {
+		var err error
+		if zw, err = gzip.NewWriterLevel(&buf, c.level); err != nil {
+			return nil, err
+		}
+	} else {
+		zw.Reset(&buf)
+	}
+	defer c.writers.Put(zw)
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *gzipCodec) Decode(b []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// encode returns v encoded by c, or v if it is already encoded or
+// doesn't shrink.
+func (v ByteView) encode(c Codec) ByteView {
+	if c == nil || v.codec != nil {
+		return v
+	}
+	b := v.b
+	if b == nil {
+		b = []byte(v.s)
+	}
+	enc, err := c.Encode(b)
+	if err != nil || len(enc) >= len(b) {
+		return v
+	}
+	return ByteView{b: enc, e: v.e, codec: c}
+}
+
+// decode returns v decoded.
+func (v ByteView) decode() (ByteView, error) {
+	if v.codec == nil {
+		return v, nil
+	}
+	b, err := v.codec.Decode(v.b)
+	if err != nil {
+		return ByteView{}, fmt.Errorf("groupcache: decoding %s value: %v", v.codec.Name(), err)
+	}
+	return ByteView{b: b, e: v.e}, nil
+}
+
+// forPeer returns v as sent to a peer that accepts values encoded by
+// the given codecs: decoded, unless its codec is one of them.
+func (v ByteView) forPeer(accept []string) (ByteView, error) {
+	if v.codec == nil {
+		return v, nil
+	}
+	for _, name := range accept {
+		if name == v.codec.Name() {
+			return v, nil
+		}
+	}
+	return v.decode()
+}
+
+// acceptCodec returns the codecs in which g accepts values from peers.
+func (g *Group) acceptCodec() []string {
+	if g.opts.Codec == nil {
+		return nil
+	}
+	return []string{g.opts.Codec.Name()}
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consistenthash
+
+import (
+	"math"
+	"sync"
+)
+
+// BoundedMap is a ring hash with bounded loads, as described in
+// "Consistent Hashing with Bounded Loads" by Mirrokni, Thorup and
+// Zadimoghaddam. Callers report the load of each item with Inc and
+// Done; Get returns the first item on the ring, starting from the
+// key's position, whose load is under (1+epsilon) times the average
+// load, or its share of the total load for items added with
+// AddWeighted. No item is then loaded much more than the others, at the cost
+// of sending some keys to items other than their closest one.
+//
+// Unlike Map, BoundedMap is safe for concurrent use.
+type BoundedMap struct {
+	epsilon float64
+
+	mu      sync.Mutex
+	m       *Map
+	loads   map[string]int64 // of each item
+	total   int64            // sum of loads
+	weights map[string]int   // of each item
+	sum     int              // of weights
+}
+
+// NewBounded returns a BoundedMap with the given number of replicas
+// for each item and hash function, which defaults to
+// crc32.ChecksumIEEE if nil. An epsilon of 0.25 allows items 25% more
+// load than the average.
+func NewBounded(replicas int, fn Hash, epsilon float64) *BoundedMap {
+	return &BoundedMap{
+		epsilon: epsilon,
+		m:       New(replicas, fn),
+		loads:   make(map[string]int64),
+		weights: make(map[string]int),
+	}
+}
+
+// IsEmpty returns true if there are no items available.
+func (b *BoundedMap) IsEmpty() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.m.IsEmpty()
+}
+
+// Add adds some items to the hash, with no load. Items already in
+// the hash are ignored.
+func (b *BoundedMap) Add(items ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	added := make([]string, 0, len(items))
+	for _, item := range items {
+		if _, ok := b.loads[item]; !ok {
+			b.loads[item] = 0
+			b.weights[item] = 1
+			b.sum++
+			added = append(added, item)
+		}
+	}
+	b.m.Add(added...)
+}
+
+// AddWeighted is like Add, but gives each item a number of replicas
+// and a share of the total load proportional to its weight. Items
+// with a weight under 1 are ignored.
+func (b *BoundedMap) AddWeighted(weights map[string]int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	added := make(map[string]int, len(weights))
+	for item, weight := range weights {
+		if _, ok := b.loads[item]; !ok && weight > 0 {
+			b.loads[item] = 0
+			b.weights[item] = weight
+			b.sum += weight
+			added[item] = weight
+		}
+	}
+	b.m.AddWeighted(added)
+}
+
+// Remove removes some items from the hash, with their loads.
+func (b *BoundedMap) Remove(items ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, item := range items {
+		b.total -= b.loads[item]
+		b.sum -= b.weights[item]
+		delete(b.loads, item)
+		delete(b.weights, item)
+	}
+	b.m.Remove(items...)
+}
+
+// Get returns the item for key: the closest item in the hash to key
+// whose load, once incremented, would not exceed (1+epsilon) times
+// its share of the total load.
+func (b *BoundedMap) Get(key string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.m.IsEmpty() {
+		return ""
+	}
+	// The shares count the load that key is about to add.
+	perWeight := (1 + b.epsilon) * float64(b.total+1) / float64(b.sum)
+	idx := b.m.search(key)
+	for i := range b.m.keys {
+		item := b.m.hashMap[b.m.keys[(idx+i)%len(b.m.keys)]]
+		limit := int64(math.Ceil(perWeight * float64(b.weights[item])))
+		if b.loads[item]+1 <= limit {
+			return item
+		}
+	}
+	// Not reached: some item is always at most at its share.
+	return b.m.hashMap[b.m.keys[idx]]
+}
+
+// Items returns the items, sorted, with their replicas and the
+// fractions of the keys they own before loads are bounded.
+func (b *BoundedMap) Items() []Item {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.m.Items()
+}
+
+// Inc records that item started serving a request.
+func (b *BoundedMap) Inc(item string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.loads[item]; ok {
+		b.loads[item]++
+		b.total++
+	}
+}
+
+// Done records that item finished serving a request recorded by Inc.
+func (b *BoundedMap) Done(item string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.loads[item] > 0 {
+		b.loads[item]--
+		b.total--
+	}
+}
+
+// Load returns the load of item.
+func (b *BoundedMap) Load(item string) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.loads[item]
+}
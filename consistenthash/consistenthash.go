@@ -30,6 +30,7 @@ type Map struct {
 	replicas int
 	keys     []int // Sorted
 	hashMap  map[int]string
+	nodes    map[string]int // number of replicas of each key
 }
 
 func New(replicas int, fn Hash) *Map {
@@ -37,6 +38,7 @@ func New(replicas int, fn Hash) *Map {
 		replicas: replicas,
 		hash:     fn,
 		hashMap:  make(map[int]string),
+		nodes:    make(map[string]int),
 	}
 	if m.hash == nil {
 		m.hash = crc32.ChecksumIEEE
@@ -52,21 +54,123 @@ func (m *Map) IsEmpty() bool {
 // Add adds some keys to the hash.
 func (m *Map) Add(keys ...string) {
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = key
+		m.add(key, m.replicas)
+	}
+	sort.Ints(m.keys)
+}
+
+// AddWeighted adds some keys to the hash, each with a number of
+// replicas proportional to its weight: a key of weight 2 gets twice
+// as many replicas, and so twice the share of items, as a key added
+// with Add. Keys with a weight under 1 are ignored.
+func (m *Map) AddWeighted(weights map[string]int) {
+	// Add the keys in a fixed order, so that maps built from the
+	// same weights agree on the owners of colliding hashes.
+	keys := make([]string, 0, len(weights))
+	for key, weight := range weights {
+		if weight > 0 {
+			keys = append(keys, key)
 		}
 	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		m.add(key, m.replicas*weights[key])
+	}
 	sort.Ints(m.keys)
 }
 
+// add adds key with n replicas, leaving m.keys unsorted.
+func (m *Map) add(key string, n int) {
+	for i := 0; i < n; i++ {
+		hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+		m.keys = append(m.keys, hash)
+		m.hashMap[hash] = key
+	}
+	m.nodes[key] = n
+}
+
+// Remove removes some keys from the hash. The remaining keys keep
+// their positions, so only the items of removed keys move.
+func (m *Map) Remove(keys ...string) {
+	removed := make(map[int]bool)
+	for _, key := range keys {
+		for i := 0; i < m.nodes[key]; i++ {
+			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+			if m.hashMap[hash] == key {
+				delete(m.hashMap, hash)
+				removed[hash] = true
+			}
+		}
+		delete(m.nodes, key)
+	}
+	if len(removed) == 0 {
+		return
+	}
+	// Filter in place, which keeps m.keys sorted.
+	kept := m.keys[:0]
+	for _, hash := range m.keys {
+		if !removed[hash] {
+			kept = append(kept, hash)
+		}
+	}
+	m.keys = kept
+}
+
 // Get gets the closest item in the hash to the provided key.
 func (m *Map) Get(key string) string {
 	if m.IsEmpty() {
 		return ""
 	}
 
+	return m.hashMap[m.keys[m.search(key)]]
+}
+
+// GetN gets the n closest distinct items in the hash to the provided
+// key, closest first, or all the items if there are fewer than n.
+func (m *Map) GetN(key string, n int) []string {
+	if m.IsEmpty() || n <= 0 {
+		return nil
+	}
+	if n > len(m.nodes) {
+		n = len(m.nodes)
+	}
+	items := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	idx := m.search(key)
+	for i := 0; i < len(m.keys) && len(items) < n; i++ {
+		item := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if !seen[item] {
+			seen[item] = true
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Items returns the keys in the hash, sorted, with their numbers of
+// replicas and the fractions of the hash space they own.
+func (m *Map) Items() []Item {
+	owned := make(map[string]uint64, len(m.nodes))
+	for i, hash := range m.keys {
+		// The replica owns the hashes since the previous one,
+		// wrapping around the end of the ring.
+		prev := m.keys[(i+len(m.keys)-1)%len(m.keys)]
+		arc := uint64(uint32(hash) - uint32(prev))
+		if len(m.keys) == 1 {
+			arc = 1 << 32
+		}
+		owned[m.hashMap[hash]] += arc
+	}
+	items := make([]Item, 0, len(m.nodes))
+	for key, n := range m.nodes {
+		items = append(items, Item{Name: key, Nodes: n, Share: float64(owned[key]) / (1 << 32)})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items
+}
+
+// search returns the index in m.keys of the closest replica to key.
+func (m *Map) search(key string) int {
 	hash := int(m.hash([]byte(key)))
 
 	// Binary search for appropriate replica.
@@ -76,6 +180,5 @@ func (m *Map) Get(key string) string {
 	if idx == len(m.keys) {
 		idx = 0
 	}
-
-	return m.hashMap[m.keys[idx]]
+	return idx
 }
@@ -19,6 +19,7 @@ package consistenthash
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -65,6 +66,192 @@ func TestHashing(t *testing.T) {
 
 }
 
+func TestRemove(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, err := strconv.Atoi(string(key))
+		if err != nil {
+			panic(err)
+		}
+		return uint32(i)
+	})
+
+	// Replicas with "hashes" 2, 4, 6, 12, 14, 16, 22, 24, 26.
+	hash.Add("6", "4", "2")
+
+	// Removes 4, 14, 24; 8 was never added.
+	hash.Remove("4", "8")
+
+	testCases := map[string]string{
+		"2":  "2",
+		"3":  "6",
+		"13": "6",
+		"23": "6",
+		"27": "2",
+	}
+	for k, v := range testCases {
+		if hash.Get(k) != v {
+			t.Errorf("Asking for %s, should have yielded %s", k, v)
+		}
+	}
+
+	hash.Remove("6", "2")
+	if !hash.IsEmpty() {
+		t.Errorf("hash not empty after removing every key")
+	}
+	if hash.Get("2") != "" {
+		t.Errorf("empty hash yielded %q", hash.Get("2"))
+	}
+}
+
+func TestGetN(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, err := strconv.Atoi(string(key))
+		if err != nil {
+			panic(err)
+		}
+		return uint32(i)
+	})
+
+	// Replicas with "hashes" 2, 4, 6, 12, 14, 16, 22, 24, 26.
+	hash.Add("6", "4", "2")
+
+	testCases := []struct {
+		key  string
+		n    int
+		want string
+	}{
+		{"11", 1, "2"},
+		{"11", 2, "2 4"},
+		{"13", 3, "4 6 2"},
+		{"27", 5, "2 4 6"},
+		{"27", 0, ""},
+	}
+	for _, tc := range testCases {
+		if got := strings.Join(hash.GetN(tc.key, tc.n), " "); got != tc.want {
+			t.Errorf("GetN(%s, %d) = %q; want %q", tc.key, tc.n, got, tc.want)
+		}
+	}
+
+	r := NewRendezvous(nil)
+	r.Add(testItems(5)...)
+	for _, key := range testKeys(100) {
+		items := r.GetN(key, 3)
+		if len(items) != 3 || items[0] != r.Get(key) {
+			t.Fatalf("Rendezvous.GetN(%s, 3) = %v; want 3 items starting with %s", key, items, r.Get(key))
+		}
+	}
+}
+
+func TestAddWeighted(t *testing.T) {
+	hash := New(50, nil)
+	hash.AddWeighted(map[string]int{"small": 1, "large": 4, "none": 0})
+
+	owned := make(map[string]int)
+	const n = 10000
+	for i := 0; i < n; i++ {
+		owned[hash.Get(strconv.Itoa(i))]++
+	}
+	if owned["none"] != 0 {
+		t.Errorf("key of weight 0 owns %d items", owned["none"])
+	}
+	if share := float64(owned["large"]) / n; share < 0.7 || share > 0.9 {
+		t.Errorf("key of weight 4 of 5 owns %.2f of the items; want about 0.8", share)
+	}
+
+	// A weight of 1 is the same as Add.
+	unweighted := New(50, nil)
+	unweighted.Add("small")
+	weighted := New(50, nil)
+	weighted.AddWeighted(map[string]int{"small": 1})
+	for i := 0; i < 100; i++ {
+		unweighted.Add("other" + strconv.Itoa(i))
+		weighted.Add("other" + strconv.Itoa(i))
+		if k := strconv.Itoa(i); unweighted.Get(k) != weighted.Get(k) {
+			t.Fatalf("Asking for %s, weight 1 yielded %s and Add yielded %s", k, weighted.Get(k), unweighted.Get(k))
+		}
+	}
+
+	hash.Remove("large")
+	for i := 0; i < 100; i++ {
+		if got := hash.Get(strconv.Itoa(i)); got != "small" {
+			t.Fatalf("Asking for %d after removing large, got %s", i, got)
+		}
+	}
+}
+
+func TestBoundedMap(t *testing.T) {
+	hash := NewBounded(3, func(key []byte) uint32 {
+		i, err := strconv.Atoi(string(key))
+		if err != nil {
+			panic(err)
+		}
+		return uint32(i)
+	}, 0)
+
+	// Replicas with "hashes" 2, 4, 6, 12, 14, 16, 22, 24, 26.
+	hash.Add("6", "4", "2")
+
+	if got := hash.Get("11"); got != "2" {
+		t.Fatalf("Asking for 11 without load, got %s; want 2", got)
+	}
+
+	// Over the average, 2 is skipped for the next item on the ring.
+	hash.Inc("2")
+	hash.Inc("2")
+	if got := hash.Get("11"); got != "4" {
+		t.Errorf("Asking for 11 with 2 loaded, got %s; want 4", got)
+	}
+	hash.Done("2")
+	hash.Done("2")
+	if got := hash.Get("11"); got != "2" {
+		t.Errorf("Asking for 11 after 2 is done, got %s; want 2", got)
+	}
+
+	hash.Inc("4")
+	hash.Remove("4")
+	if n := hash.Load("4"); n != 0 {
+		t.Errorf("Load of a removed item = %d; want 0", n)
+	}
+	if got := hash.Get("13"); got != "6" {
+		t.Errorf("Asking for 13 after removing 4, got %s; want 6", got)
+	}
+}
+
+func TestBoundedMapLoads(t *testing.T) {
+	const epsilon = 0.25
+	hash := NewBounded(50, nil, epsilon)
+	var items []string
+	for i := 0; i < 8; i++ {
+		items = append(items, fmt.Sprintf("shard-%d", i))
+	}
+	hash.Add(items...)
+
+	// Every key is the same, the worst skew there is.
+	const n = 1000
+	for i := 0; i < n; i++ {
+		hash.Inc(hash.Get("hot"))
+	}
+	limit := int64((1 + epsilon) * n / float64(len(items)))
+	for _, item := range items {
+		if load := hash.Load(item); load > limit+1 {
+			t.Errorf("Load(%s) = %d; want at most %d", item, load, limit+1)
+		}
+	}
+}
+
+func TestBoundedMapWeighted(t *testing.T) {
+	hash := NewBounded(50, nil, 0)
+	hash.AddWeighted(map[string]int{"small": 1, "large": 3})
+
+	const n = 400
+	for i := 0; i < n; i++ {
+		hash.Inc(hash.Get("hot"))
+	}
+	if small, large := hash.Load("small"), hash.Load("large"); small > n/4+1 || large > 3*n/4+1 {
+		t.Errorf("loads = %d and %d; want at most %d and %d", small, large, n/4+1, 3*n/4+1)
+	}
+}
+
 func TestConsistency(t *testing.T) {
 	hash1 := New(1, nil)
 	hash2 := New(1, nil)
@@ -86,6 +273,140 @@ func TestConsistency(t *testing.T) {
 
 }
 
+var testPickers = []struct {
+	name string
+	new  func() Picker
+}{
+	{"ring10", func() Picker { return New(10, nil) }},
+	{"ring50", func() Picker { return New(50, nil) }},
+	{"rendezvous", func() Picker { return NewRendezvous(nil) }},
+	{"jump", func() Picker { return NewJump(nil) }},
+}
+
+func testItems(n int) []string {
+	items := make([]string, n)
+	for i := range items {
+		items[i] = fmt.Sprintf("shard-%d", i)
+	}
+	return items
+}
+
+func testKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	return keys
+}
+
+// balance returns the number of keys of the most loaded item of p,
+// relative to the average.
+func balance(p Picker, items, keys []string) float64 {
+	owned := make(map[string]int)
+	max := 0
+	for _, key := range keys {
+		item := p.Get(key)
+		owned[item]++
+		if owned[item] > max {
+			max = owned[item]
+		}
+	}
+	return float64(max) * float64(len(items)) / float64(len(keys))
+}
+
+// moved returns the fraction of keys that move when newPicker gets
+// one more item than items.
+func moved(newPicker func() Picker, items, keys []string) float64 {
+	before, after := newPicker(), newPicker()
+	before.Add(items...)
+	after.Add(items...)
+	after.Add("shard-new")
+	n := 0
+	for _, key := range keys {
+		if before.Get(key) != after.Get(key) {
+			n++
+		}
+	}
+	return float64(n) / float64(len(keys))
+}
+
+func TestPickers(t *testing.T) {
+	items := testItems(10)
+	keys := testKeys(10000)
+	for _, tt := range testPickers {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.new()
+			if p.Get("key") != "" {
+				t.Errorf("empty picker yielded %q", p.Get("key"))
+			}
+			p.Add(items...)
+			same := tt.new()
+			same.Add(items...)
+			for _, key := range keys[:100] {
+				if p.Get(key) != same.Get(key) {
+					t.Fatalf("Asking for %s from two pickers with the same items differs", key)
+				}
+			}
+
+			if b := balance(p, items, keys); b > 1.5 {
+				t.Errorf("most loaded item has %.2f times the average keys", b)
+			}
+			// Ideally 1/11 of the keys move to the new item.
+			if m := moved(tt.new, items, keys); m > 0.15 {
+				t.Errorf("adding an item moved %.2f of the keys", m)
+			}
+
+			// Removing the last item only moves its keys.
+			owners := make(map[string]string)
+			for _, key := range keys[:1000] {
+				owners[key] = p.Get(key)
+			}
+			p.Remove(items[len(items)-1])
+			for key, owner := range owners {
+				if got := p.Get(key); owner != items[len(items)-1] && got != owner {
+					t.Fatalf("Asking for %s after a removal, got %s; want %s", key, got, owner)
+				} else if got == items[len(items)-1] {
+					t.Fatalf("Asking for %s yielded the removed item", key)
+				}
+			}
+
+			weighted := tt.new()
+			weighted.AddWeighted(map[string]int{"a": 1, "b": 1, "c": 1, "big": 3})
+			n := 0
+			for _, key := range keys {
+				if weighted.Get(key) == "big" {
+					n++
+				}
+			}
+			if share := float64(n) / float64(len(keys)); share < 0.35 || share > 0.65 {
+				t.Errorf("item of weight 3 of 6 owns %.2f of the keys; want about 0.5", share)
+			}
+		})
+	}
+}
+
+// BenchmarkPickers measures the speed of Get, and reports the
+// balance of the keys over the items (1 is perfect) and the fraction
+// of keys moved by adding an item (1/(items+1) is perfect).
+func BenchmarkPickers(b *testing.B) {
+	keys := testKeys(10000)
+	for _, tt := range testPickers {
+		for _, n := range []int{8, 128} {
+			b.Run(fmt.Sprintf("%s/%d", tt.name, n), func(b *testing.B) {
+				items := testItems(n)
+				p := tt.new()
+				p.Add(items...)
+				for i := 0; i < b.N; i++ {
+					p.Get(keys[i%len(keys)])
+				}
+				b.StopTimer()
+				b.ReportMetric(balance(p, items, keys), "max/avg")
+				b.ReportMetric(moved(tt.new, items, keys), "moved")
+			})
+		}
+	}
+}
+
 func BenchmarkGet8(b *testing.B)   { benchmarkGet(b, 8) }
 func BenchmarkGet32(b *testing.B)  { benchmarkGet(b, 32) }
 func BenchmarkGet128(b *testing.B) { benchmarkGet(b, 128) }
@@ -108,3 +429,32 @@ func benchmarkGet(b *testing.B, shards int) {
 		hash.Get(buckets[i&(shards-1)])
 	}
 }
+
+func TestItems(t *testing.T) {
+	keys := testKeys(10000)
+	for _, tt := range testPickers {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.new()
+			p.AddWeighted(map[string]int{"a": 1, "b": 3})
+			items := p.(ItemLister).Items()
+			if len(items) != 2 || items[0].Name != "a" || items[1].Name != "b" {
+				t.Fatalf("Items = %+v; want a and b", items)
+			}
+			if items[1].Nodes != 3*items[0].Nodes {
+				t.Errorf("b has %d nodes and a %d; want three times as many", items[1].Nodes, items[0].Nodes)
+			}
+			if sum := items[0].Share + items[1].Share; sum < 0.999 || sum > 1.001 {
+				t.Errorf("shares sum to %v; want 1", sum)
+			}
+			got := 0
+			for _, key := range keys {
+				if p.Get(key) == "b" {
+					got++
+				}
+			}
+			if share := float64(got) / float64(len(keys)); share-items[1].Share > 0.05 || items[1].Share-share > 0.05 {
+				t.Errorf("b gets %.3f of the keys; Items says %.3f", share, items[1].Share)
+			}
+		})
+	}
+}
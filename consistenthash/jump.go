@@ -0,0 +1,111 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consistenthash
+
+import "sort"
+
+// Jump implements jump consistent hashing, as described in "A Fast,
+// Minimal Memory, Consistent Hash Algorithm" by Lamping and Veach. It
+// spreads keys evenly over its items in constant memory and time
+// logarithmic in the number of items.
+//
+// Jump numbers its items in the order they were added, and only
+// adding or removing the last items is consistent: removing another
+// item renumbers the items after it, which moves many keys. It suits
+// pools that grow and shrink at the end, such as numbered shards.
+type Jump struct {
+	hash    Hash
+	buckets []string // items, repeated by weight
+}
+
+// NewJump returns a Jump using the hash function fn. If fn is nil, a
+// 64-bit FNV-1a hash is used.
+func NewJump(fn Hash) *Jump {
+	return &Jump{hash: fn}
+}
+
+// IsEmpty returns true if there are no items available.
+func (j *Jump) IsEmpty() bool {
+	return len(j.buckets) == 0
+}
+
+// Add adds some items after the current ones.
+func (j *Jump) Add(items ...string) {
+	j.buckets = append(j.buckets, items...)
+}
+
+// AddWeighted adds some items after the current ones, in sorted
+// order, each receiving a share of the keys proportional to its
+// weight. Items with a weight under 1 are ignored.
+func (j *Jump) AddWeighted(weights map[string]int) {
+	items := make([]string, 0, len(weights))
+	for item, weight := range weights {
+		if weight > 0 {
+			items = append(items, item)
+		}
+	}
+	sort.Strings(items)
+	for _, item := range items {
+		for i := 0; i < weights[item]; i++ {
+			j.buckets = append(j.buckets, item)
+		}
+	}
+}
+
+// Remove removes some items.
+func (j *Jump) Remove(items ...string) {
+	removed := make(map[string]bool, len(items))
+	for _, item := range items {
+		removed[item] = true
+	}
+	kept := j.buckets[:0]
+	for _, item := range j.buckets {
+		if !removed[item] {
+			kept = append(kept, item)
+		}
+	}
+	j.buckets = kept
+}
+
+// Get returns the item of key.
+func (j *Jump) Get(key string) string {
+	if j.IsEmpty() {
+		return ""
+	}
+	return j.buckets[jump(hash64(j.hash, key), len(j.buckets))]
+}
+
+// Items returns the items, sorted, with their numbers of buckets and
+// the fractions of the keys they get.
+func (j *Jump) Items() []Item {
+	weights := make(map[string]int)
+	for _, item := range j.buckets {
+		weights[item]++
+	}
+	return weightedItems(weights)
+}
+
+// jump returns the bucket of key among n buckets.
+func jump(key uint64, n int) int {
+	var b, i int64 = -1, 0
+	for i < int64(n) {
+		b = i
+		key = key*2862933555777941757 + 1
+		i = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consistenthash
+
+import "sort"
+
+// A Picker maps keys to items, such as the peers owning the keys.
+// Map, BoundedMap, Rendezvous and Jump implement it.
+type Picker interface {
+	// Add adds some items.
+	Add(items ...string)
+
+	// AddWeighted adds some items, each receiving a share of the
+	// keys proportional to its weight. Items with a weight under 1
+	// are ignored.
+	AddWeighted(weights map[string]int)
+
+	// Remove removes some items.
+	Remove(items ...string)
+
+	// IsEmpty returns true if there are no items available.
+	IsEmpty() bool
+
+	// Get returns the item of key, or "" if there are no items.
+	Get(key string) string
+}
+
+// A MultiPicker is a Picker that can rank the items for a key. Map
+// and Rendezvous implement it.
+type MultiPicker interface {
+	Picker
+
+	// GetN returns the n first items for key, the item that Get
+	// returns first, or all the items if there are fewer than n.
+	GetN(key string, n int) []string
+}
+
+// An Item describes how a Picker distributes keys to one of its items.
+type Item struct {
+	Name string
+
+	// Nodes is the number of virtual nodes of the item: its
+	// replicas on a ring, or its weight.
+	Nodes int
+
+	// Share is the fraction of all keys that the item gets, from 0
+	// to 1.
+	Share float64
+}
+
+// An ItemLister is a Picker that can describe how it distributes keys.
+// All the Pickers of this package implement it.
+type ItemLister interface {
+	Picker
+
+	// Items returns the items, sorted by name.
+	Items() []Item
+}
+
+var (
+	_ Picker = (*Map)(nil)
+	_ Picker = (*BoundedMap)(nil)
+	_ Picker = (*Rendezvous)(nil)
+	_ Picker = (*Jump)(nil)
+
+	_ MultiPicker = (*Map)(nil)
+	_ MultiPicker = (*Rendezvous)(nil)
+
+	_ ItemLister = (*Map)(nil)
+	_ ItemLister = (*BoundedMap)(nil)
+	_ ItemLister = (*Rendezvous)(nil)
+	_ ItemLister = (*Jump)(nil)
+)
+
+// weightedItems returns the items of weights, each with a share of
+// the keys proportional to its weight.
+func weightedItems(weights map[string]int) []Item {
+	sum := 0
+	for _, w := range weights {
+		sum += w
+	}
+	items := make([]Item, 0, len(weights))
+	for name, w := range weights {
+		items = append(items, Item{Name: name, Nodes: w, Share: float64(w) / float64(sum)})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items
+}
+
+// hash64 returns a well mixed 64-bit hash of the concatenation of s,
+// using fn if it is not nil.
+func hash64(fn Hash, s ...string) uint64 {
+	if fn != nil {
+		var b []byte
+		for _, s := range s {
+			b = append(b, s...)
+		}
+		return mix64(uint64(fn(b)))
+	}
+	// FNV-1a.
+	h := uint64(14695981039346656037)
+	for _, s := range s {
+		for i := 0; i < len(s); i++ {
+			h ^= uint64(s[i])
+			h *= 1099511628211
+		}
+	}
+	return mix64(h)
+}
+
+// mix64 is the finalizer of SplitMix64, which spreads every bit of h
+// over the whole result.
+func mix64(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consistenthash
+
+import (
+	"math"
+	"sort"
+)
+
+// Rendezvous implements rendezvous, or highest random weight, hashing:
+// each key goes to the item that scores highest for it, where scores
+// are hashes of the item and key. Keys are spread evenly without
+// replicas, so it takes memory proportional to the number of items,
+// and removing an item only moves the keys it had. Get takes time
+// proportional to the number of items.
+type Rendezvous struct {
+	hash    Hash
+	items   []string       // sorted
+	weights map[string]int // of each item
+}
+
+// NewRendezvous returns a Rendezvous using the hash function fn. If fn
+// is nil, a 64-bit FNV-1a hash is used.
+func NewRendezvous(fn Hash) *Rendezvous {
+	return &Rendezvous{
+		hash:    fn,
+		weights: make(map[string]int),
+	}
+}
+
+// IsEmpty returns true if there are no items available.
+func (r *Rendezvous) IsEmpty() bool {
+	return len(r.items) == 0
+}
+
+// Add adds some items.
+func (r *Rendezvous) Add(items ...string) {
+	for _, item := range items {
+		r.add(item, 1)
+	}
+	sort.Strings(r.items)
+}
+
+// AddWeighted adds some items, each receiving a share of the keys
+// proportional to its weight. Items with a weight under 1 are ignored.
+func (r *Rendezvous) AddWeighted(weights map[string]int) {
+	for item, weight := range weights {
+		if weight > 0 {
+			r.add(item, weight)
+		}
+	}
+	sort.Strings(r.items)
+}
+
+func (r *Rendezvous) add(item string, weight int) {
+	if _, ok := r.weights[item]; !ok {
+		r.items = append(r.items, item)
+	}
+	r.weights[item] = weight
+}
+
+// Remove removes some items.
+func (r *Rendezvous) Remove(items ...string) {
+	for _, item := range items {
+		delete(r.weights, item)
+	}
+	kept := r.items[:0]
+	for _, item := range r.items {
+		if _, ok := r.weights[item]; ok {
+			kept = append(kept, item)
+		}
+	}
+	r.items = kept
+}
+
+// Get returns the item that scores highest for key.
+func (r *Rendezvous) Get(key string) string {
+	var (
+		best  string
+		score = math.Inf(-1)
+	)
+	for _, item := range r.items {
+		if s := r.score(item, key); s > score {
+			best, score = item, s
+		}
+	}
+	return best
+}
+
+// GetN returns the n items that score highest for key, highest first,
+// or all the items if there are fewer than n.
+func (r *Rendezvous) GetN(key string, n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	items := append([]string(nil), r.items...)
+	scores := make(map[string]float64, len(items))
+	for _, item := range items {
+		scores[item] = r.score(item, key)
+	}
+	sort.Slice(items, func(i, j int) bool { return scores[items[i]] > scores[items[j]] })
+	if n > len(items) {
+		n = len(items)
+	}
+	return items[:n]
+}
+
+// Items returns the items, sorted, with their weights and the
+// fractions of the keys they get.
+func (r *Rendezvous) Items() []Item {
+	return weightedItems(r.weights)
+}
+
+// score returns the score of item for key.
+func (r *Rendezvous) score(item, key string) float64 {
+	// Weighted rendezvous hashing: with h uniform in (0, 1),
+	// -weight/ln(h) picks each item with a probability proportional
+	// to its weight.
+	h := (float64(hash64(r.hash, item, "\x00", key)>>11) + 0.5) / (1 << 53)
+	return -float64(r.weights[item]) / math.Log(h)
+}
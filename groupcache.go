@@ -27,13 +27,16 @@ package groupcache
 import (
 	"context"
 	"errors"
+	"fmt"
+	"math"
 	"math/rand"
+	"sort"
 	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	pb "github.com/golang/groupcache/groupcachepb"
-	"github.com/golang/groupcache/lru"
 	"github.com/golang/groupcache/singleflight"
 )
 
@@ -43,8 +46,9 @@ type Getter interface {
 	//
 	// The returned data must be unversioned. That is, key must
 	// uniquely describe the loaded data, without an implicit
-	// current time, and without relying on cache expiration
-	// mechanisms.
+	// current time. Data that is only valid for a limited time
+	// must say so with dest.SetExpire; it is then dropped from
+	// the caches of all peers at that time.
 	Get(ctx context.Context, key string, dest Sink) error
 }
 
@@ -55,23 +59,76 @@ func (f GetterFunc) Get(ctx context.Context, key string, dest Sink) error {
 	return f(ctx, key, dest)
 }
 
-var (
+// ErrNotFound is returned by a Getter to report that key has no value.
+// Unlike other errors, it is passed on to callers on other peers as
+// is, and may be cached; see GroupOptions.NotFoundExpiry.
+var ErrNotFound = errors.New("groupcache: not found")
+
+// ErrClosed is returned by the methods of a Group after Close.
+var ErrClosed = errors.New("groupcache: group closed")
+
+// A Registry is a set of named groups together with the PeerPicker
+// and hooks they share. Groups in different registries are
+// independent, so that a process can take part in several clusters
+// of peers at once.
+//
+// The package-level functions such as NewGroup, GetGroup and
+// RegisterPeerPicker operate on DefaultRegistry.
+type Registry struct {
 	mu     sync.RWMutex
-	groups = make(map[string]*Group)
+	groups map[string]*Group
 
 	initPeerServerOnce sync.Once
 	initPeerServer     func()
-)
+
+	// newGroupHook, if non-nil, is called right after a new group is created.
+	newGroupHook func(*Group)
+
+	portPicker func(groupName string) PeerPicker
+}
+
+// NewRegistry returns a new, empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		groups: make(map[string]*Group),
+	}
+}
+
+// DefaultRegistry is the Registry used by the package-level functions.
+var DefaultRegistry = NewRegistry()
 
 // GetGroup returns the named group previously created with NewGroup, or
 // nil if there's no such group.
 func GetGroup(name string) *Group {
-	mu.RLock()
-	g := groups[name]
-	mu.RUnlock()
+	return DefaultRegistry.GetGroup(name)
+}
+
+// GetGroup returns the named group previously created with
+// r.NewGroup, or nil if there's no such group.
+func (r *Registry) GetGroup(name string) *Group {
+	r.mu.RLock()
+	g := r.groups[name]
+	r.mu.RUnlock()
 	return g
 }
 
+// Groups returns the groups of DefaultRegistry, sorted by name.
+func Groups() []*Group {
+	return DefaultRegistry.Groups()
+}
+
+// Groups returns the groups of r, sorted by name.
+func (r *Registry) Groups() []*Group {
+	r.mu.RLock()
+	groups := make([]*Group, 0, len(r.groups))
+	for _, g := range r.groups {
+		groups = append(groups, g)
+	}
+	r.mu.RUnlock()
+	sort.Slice(groups, func(i, j int) bool { return groups[i].name < groups[j].name })
+	return groups
+}
+
 // NewGroup creates a coordinated group-aware Getter from a Getter.
 //
 // The returned Getter tries (but does not guarantee) to run only one
@@ -82,58 +139,179 @@ func GetGroup(name string) *Group {
 //
 // The group name must be unique for each getter.
 func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
-	return newGroup(name, cacheBytes, getter, nil)
+	return DefaultRegistry.NewGroup(name, cacheBytes, getter)
+}
+
+// NewGroup is like the package-level NewGroup, but registers the group
+// in r. The group name must be unique within r.
+func (r *Registry) NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+	return r.newGroup(name, cacheBytes, getter, nil, nil)
+}
+
+// GroupOptions are the configurations of a Group.
+type GroupOptions struct {
+	// NotFoundExpiry specifies how long the mainCache remembers
+	// that the Getter returned ErrNotFound for a key.
+	// If zero, ErrNotFound results are not cached.
+	NotFoundExpiry time.Duration
+
+	// HotKeyQPS specifies the request rate, in queries per second
+	// over the last minute as reported by a key's owner, at which
+	// a key fetched from a peer is mirrored in the hotCache.
+	// If zero, it defaults to 10.
+	HotKeyQPS float64
+
+	// EvictionPolicy creates the eviction policy of the mainCache
+	// and of the hotCache.
+	// If nil, it defaults to NewLRUPolicy.
+	EvictionPolicy PolicyFunc
+
+	// CacheSplit decides how the group's cacheBytes are divided
+	// between the mainCache and the hotCache.
+	// If nil, the hotCache may hold up to an eighth of the size of
+	// the mainCache.
+	CacheSplit CacheSplit
+
+	// HedgeDelay specifies how long a load waits for the owner of a
+	// key before it hedges: it races the owner against the next
+	// owner of the key, or against a local load if there is none,
+	// and takes whichever answers first.
+	// If zero, loads are not hedged.
+	HedgeDelay time.Duration
+
+	// Codec optionally specifies how values are compressed in the
+	// group's caches and between peers that use the same Codec,
+	// such as GzipCodec(gzip.DefaultCompression). Values are
+	// decompressed for the group's callers.
+	Codec Codec
+
+	// Tracer optionally starts spans that time the steps of the
+	// group's Gets, including those of peers' requests.
+	// If nil, Gets are not traced.
+	Tracer Tracer
+
+	// Observer optionally receives the group's loads, peer errors,
+	// evictions and hotCache promotions.
+	Observer Observer
+}
+
+const defaultHotKeyQPS = 10
+
+// NewGroupOpts is like NewGroup, but creates the group with the given
+// options.
+func NewGroupOpts(name string, cacheBytes int64, getter Getter, o *GroupOptions) *Group {
+	return DefaultRegistry.NewGroupOpts(name, cacheBytes, getter, o)
+}
+
+// NewGroupOpts is like r.NewGroup, but creates the group with the
+// given options.
+func (r *Registry) NewGroupOpts(name string, cacheBytes int64, getter Getter, o *GroupOptions) *Group {
+	return r.newGroup(name, cacheBytes, getter, nil, o)
+}
+
+func newGroup(name string, cacheBytes int64, getter Getter, peers PeerPicker, o *GroupOptions) *Group {
+	return DefaultRegistry.newGroup(name, cacheBytes, getter, peers, o)
 }
 
 // If peers is nil, the peerPicker is called via a sync.Once to initialize it.
-func newGroup(name string, cacheBytes int64, getter Getter, peers PeerPicker) *Group {
+func (r *Registry) newGroup(name string, cacheBytes int64, getter Getter, peers PeerPicker, o *GroupOptions) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
-	mu.Lock()
-	defer mu.Unlock()
-	initPeerServerOnce.Do(callInitPeerServer)
-	if _, dup := groups[name]; dup {
-		panic("duplicate registration of group " + name)
-	}
+	// The hooks run without r.mu held, so that they may register
+	// peer pickers, as creating an HTTPPool does.
+	r.initPeerServerOnce.Do(r.callInitPeerServer)
+	r.checkUnique(name)
 	g := &Group{
 		name:       name,
+		registry:   r,
 		getter:     getter,
 		peers:      peers,
 		cacheBytes: cacheBytes,
 		loadGroup:  &singleflight.Group{},
 	}
-	if fn := newGroupHook; fn != nil {
-		fn(g)
+	if o != nil {
+		g.opts = *o
 	}
-	groups[name] = g
+	g.mainCache.newPolicy = g.opts.EvictionPolicy
+	g.hotCache.newPolicy = g.opts.EvictionPolicy
+	g.mainCache.onEvict = g.observeEvict(MainCache)
+	g.hotCache.onEvict = g.observeEvict(HotCache)
+	r.mu.RLock()
+	hook := r.newGroupHook
+	r.mu.RUnlock()
+	if hook != nil {
+		hook(g)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkUniqueLocked(name)
+	r.groups[name] = g
 	return g
 }
 
-// newGroupHook, if non-nil, is called right after a new group is created.
-var newGroupHook func(*Group)
+// checkUnique panics if a group named name is registered in r.
+func (r *Registry) checkUnique(name string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.checkUniqueLocked(name)
+}
+
+func (r *Registry) checkUniqueLocked(name string) {
+	if _, dup := r.groups[name]; dup {
+		panic("duplicate registration of group " + name)
+	}
+}
+
+// removeGroup unregisters g, if it is still registered in r.
+func (r *Registry) removeGroup(g *Group) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.groups[g.name] == g {
+		delete(r.groups, g.name)
+	}
+}
 
 // RegisterNewGroupHook registers a hook that is run each time
 // a group is created.
 func RegisterNewGroupHook(fn func(*Group)) {
-	if newGroupHook != nil {
+	DefaultRegistry.RegisterNewGroupHook(fn)
+}
+
+// RegisterNewGroupHook registers a hook that is run each time
+// a group is created in r.
+func (r *Registry) RegisterNewGroupHook(fn func(*Group)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.newGroupHook != nil {
 		panic("RegisterNewGroupHook called more than once")
 	}
-	newGroupHook = fn
+	r.newGroupHook = fn
 }
 
 // RegisterServerStart registers a hook that is run when the first
 // group is created.
 func RegisterServerStart(fn func()) {
-	if initPeerServer != nil {
+	DefaultRegistry.RegisterServerStart(fn)
+}
+
+// RegisterServerStart registers a hook that is run when the first
+// group is created in r.
+func (r *Registry) RegisterServerStart(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.initPeerServer != nil {
 		panic("RegisterServerStart called more than once")
 	}
-	initPeerServer = fn
+	r.initPeerServer = fn
 }
 
-func callInitPeerServer() {
-	if initPeerServer != nil {
-		initPeerServer()
+func (r *Registry) callInitPeerServer() {
+	r.mu.RLock()
+	fn := r.initPeerServer
+	r.mu.RUnlock()
+	if fn != nil {
+		fn()
 	}
 }
 
@@ -141,10 +319,13 @@ func callInitPeerServer() {
 // a group of 1 or more machines.
 type Group struct {
 	name       string
+	registry   *Registry
 	getter     Getter
 	peersOnce  sync.Once
+	peersInit  int32 // set atomically once peers is initialized
 	peers      PeerPicker
 	cacheBytes int64 // limit for sum of mainCache and hotCache size
+	opts       GroupOptions
 
 	// mainCache is a cache of the keys for which this process
 	// (amongst its peers) is authoritative. That is, this cache
@@ -167,6 +348,17 @@ type Group struct {
 	// concurrent callers.
 	loadGroup flightGroup
 
+	// peerStats holds the *PeerStats of each peer, by name.
+	peerStats sync.Map
+
+	peerErrMu sync.Mutex  // guards peerErrs and nPeerErrs
+	peerErrs  []PeerError // the last maxPeerErrors, in a ring
+	nPeerErrs int         // recorded in total
+
+	closeMu  sync.RWMutex // guards closed and additions to inflight
+	closed   bool
+	inflight sync.WaitGroup // calls in progress, waited for by Close
+
 	_ int32 // force Stats to be 8-byte aligned on 32-bit platforms
 
 	// Stats are statistics on the group.
@@ -196,6 +388,10 @@ type Stats struct {
 	LocalLoads     AtomicInt // total good local loads
 	LocalLoadErrs  AtomicInt // total bad local loads
 	ServerRequests AtomicInt // gets that came over the network from peers
+	NotFounds      AtomicInt // ErrNotFound from either cache, a peer or a local load
+	Hedges         AtomicInt // hedged requests issued
+	HedgesWon      AtomicInt // hedged requests that answered first
+	AuthRejects    AtomicInt // requests from peers that failed authentication
 }
 
 // Name returns the name of the group.
@@ -203,22 +399,73 @@ func (g *Group) Name() string {
 	return g.name
 }
 
+// Close removes g from its Registry, so that a new group of the same
+// name may be created, and waits for the calls in progress to finish
+// before releasing the memory of g's caches. Subsequent calls to the
+// methods of g return ErrClosed.
+func (g *Group) Close() error {
+	g.closeMu.Lock()
+	if g.closed {
+		g.closeMu.Unlock()
+		return ErrClosed
+	}
+	g.closed = true
+	g.closeMu.Unlock()
+
+	g.registry.removeGroup(g)
+	g.inflight.Wait()
+	g.mainCache.clear()
+	g.hotCache.clear()
+	return nil
+}
+
+// begin records the start of a call, reporting false if g is closed.
+// Each successful begin must be matched by a call to done.
+func (g *Group) begin() bool {
+	g.closeMu.RLock()
+	defer g.closeMu.RUnlock()
+	if g.closed {
+		return false
+	}
+	g.inflight.Add(1)
+	return true
+}
+
+func (g *Group) done() {
+	g.inflight.Done()
+}
+
 func (g *Group) initPeers() {
 	if g.peers == nil {
-		g.peers = getPeers(g.name)
+		g.peers = g.registry.getPeers(g.name)
 	}
+	atomic.StoreInt32(&g.peersInit, 1)
 }
 
 func (g *Group) Get(ctx context.Context, key string, dest Sink) error {
+	if !g.begin() {
+		return ErrClosed
+	}
+	defer g.done()
 	g.peersOnce.Do(g.initPeers)
+	return g.get(ctx, key, dest, g.peers)
+}
+
+// get is like Get, but loads key through peers.
+func (g *Group) get(ctx context.Context, key string, dest Sink, peers PeerPicker) (err error) {
 	g.Stats.Gets.Add(1)
 	if dest == nil {
 		return errors.New("groupcache: nil dest Sink")
 	}
-	value, cacheHit := g.lookupCache(key)
+	ctx, span := g.startSpan(ctx, "Get", key)
+	defer func() { span.End(err) }()
+	value, cacheHit, err := g.lookupCache(ctx, key)
 
 	if cacheHit {
 		g.Stats.CacheHits.Add(1)
+		if err != nil {
+			return err
+		}
 		return setSinkView(dest, value)
 	}
 
@@ -227,7 +474,8 @@ func (g *Group) Get(ctx context.Context, key string, dest Sink) error {
 	// (if local) will set this; the losers will not. The common
 	// case will likely be one caller.
 	destPopulated := false
-	value, destPopulated, err := g.load(ctx, key, dest)
+	g.Stats.Loads.Add(1)
+	value, destPopulated, err = g.load(ctx, key, dest, peers)
 	if err != nil {
 		return err
 	}
@@ -237,9 +485,229 @@ func (g *Group) Get(ctx context.Context, key string, dest Sink) error {
 	return setSinkView(dest, value)
 }
 
-// load loads key either by invoking the getter locally or by sending it to another machine.
-func (g *Group) load(ctx context.Context, key string, dest Sink) (value ByteView, destPopulated bool, err error) {
-	g.Stats.Loads.Add(1)
+// GetMulti is like Get for several keys at once. The dest function is
+// called once for each distinct key to obtain the Sink for its value.
+//
+// Keys found in this process's caches are served directly. The
+// remaining keys are fetched with a single request to each owning
+// peer, while the keys owned by this process are loaded concurrently.
+// As with Get, a key is loaded once for concurrent Gets and GetMultis.
+// GetMulti returns the error of the first key, in the order of keys,
+// that could not be loaded; the Sinks of all other keys are populated
+// regardless.
+func (g *Group) GetMulti(ctx context.Context, keys []string, dest func(key string) Sink) error {
+	if !g.begin() {
+		return ErrClosed
+	}
+	defer g.done()
+	sinks := make(map[string]Sink, len(keys))
+	for _, key := range keys {
+		if _, dup := sinks[key]; dup {
+			continue
+		}
+		sink := dest(key)
+		if sink == nil {
+			return errors.New("groupcache: nil dest Sink")
+		}
+		sinks[key] = sink
+	}
+	g.peersOnce.Do(g.initPeers)
+	errs := g.getMulti(ctx, sinks, g.peers)
+	for _, key := range keys {
+		if err := errs[key]; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getMulti populates the Sink of each key in sinks, loading keys
+// through peers, and returns the errors of the keys that could not be
+// loaded.
+func (g *Group) getMulti(ctx context.Context, sinks map[string]Sink, peers PeerPicker) map[string]error {
+	var (
+		mu   sync.Mutex
+		errs = make(map[string]error)
+		wg   sync.WaitGroup
+	)
+	setErr := func(key string, err error) {
+		mu.Lock()
+		errs[key] = err
+		mu.Unlock()
+	}
+	loadKey := func(key string, peers PeerPicker) {
+		defer wg.Done()
+		sink := sinks[key]
+		value, destPopulated, err := g.load(ctx, key, sink, peers)
+		if err == nil && !destPopulated {
+			err = setSinkView(sink, value)
+		}
+		if err != nil {
+			setErr(key, err)
+		}
+	}
+
+	// The keys batched for peers are loaded in calls begun on
+	// loadGroup, if it supports it, so that concurrent loads of the
+	// keys wait for the batches.
+	calls := make(map[string]*singleflight.Call)
+	beginner, _ := g.loadGroup.(interface {
+		Begin(key string) (*singleflight.Call, bool)
+	})
+	// loaded ends the call of a batched key.
+	loaded := func(key string, value ByteView, err error) {
+		if call := calls[key]; call != nil {
+			call.Done(value, err)
+		}
+		if err == nil {
+			err = setSinkView(sinks[key], value)
+		}
+		if err != nil {
+			setErr(key, err)
+		}
+	}
+	// loadBatched loads a batched key on its own, in its call.
+	loadBatched := func(key string, peers PeerPicker) {
+		if calls[key] == nil {
+			loadKey(key, peers)
+			return
+		}
+		defer wg.Done()
+		viewi, destPopulated, err := g.fetch(ctx, key, sinks[key], peers)
+		if destPopulated {
+			calls[key].Done(viewi, nil)
+			return
+		}
+		var value ByteView
+		if err == nil {
+			value = viewi.(ByteView)
+		}
+		loaded(key, value, err)
+	}
+
+	// A batch is a request to a peer for keys that it owns, or that it
+	// takes over from their owner if failover is set.
+	type batch struct {
+		peer     ProtoGetter
+		failover bool
+	}
+	batches := make(map[batch][]string)
+	for key, sink := range sinks {
+		g.Stats.Gets.Add(1)
+		if value, cacheHit, err := g.lookupCache(ctx, key); cacheHit {
+			g.Stats.CacheHits.Add(1)
+			if err == nil {
+				err = setSinkView(sink, value)
+			}
+			if err != nil {
+				setErr(key, err)
+			}
+			continue
+		}
+		g.Stats.Loads.Add(1)
+		if list, ownerSkipped := pickPeers(peers, key); len(list) > 0 {
+			if beginner != nil {
+				call, ok := beginner.Begin(key)
+				if !ok {
+					// Wait for the load in flight.
+					wg.Add(1)
+					go loadKey(key, peers)
+					continue
+				}
+				calls[key] = call
+			}
+			b := batch{peer: list[0], failover: ownerSkipped}
+			batches[b] = append(batches[b], key)
+			continue
+		}
+		wg.Add(1)
+		go loadKey(key, NoPeers{})
+	}
+	for b, keys := range batches {
+		multi, ok := b.peer.(ProtoMultiGetter)
+		if !ok {
+			// Fall back to one request per key.
+			for _, key := range keys {
+				wg.Add(1)
+				go loadBatched(key, peers)
+			}
+			continue
+		}
+		wg.Add(1)
+		go func(b batch, multi ProtoMultiGetter, keys []string) {
+			defer wg.Done()
+			failed, err := g.getMultiFromPeer(ctx, multi, keys, b.failover, loaded)
+			// As in load, the keys of a failed request go to
+			// the peers that take over from peer, and a key the
+			// peer failed to provide is loaded locally.
+			var next PeerPicker = NoPeers{}
+			if err != nil {
+				next = failoverPeers{peers: peers, failed: b.peer}
+			}
+			for _, key := range failed {
+				wg.Add(1)
+				go loadBatched(key, next)
+			}
+		}(b, multi, keys)
+	}
+	wg.Wait()
+	return errs
+}
+
+// getMultiFromPeer fetches keys from peer in a single request, a
+// failover request if failover is set, and passes their values, or
+// ErrNotFound, to loaded. It returns the keys that the peer failed to
+// provide, and the error of the request if it failed as a whole.
+func (g *Group) getMultiFromPeer(ctx context.Context, peer ProtoMultiGetter, keys []string, failover bool, loaded func(key string, value ByteView, err error)) (failed []string, err error) {
+	req := &pb.GetMultiRequest{
+		Group:       &g.name,
+		Key:         keys,
+		AcceptCodec: g.acceptCodec(),
+	}
+	if failover {
+		req.Failover = &failover
+	}
+	res := &pb.GetMultiResponse{}
+	start := time.Now()
+	err = peer.GetMulti(ctx, req, res)
+	g.observePeer(ctx, peer, "", start, err)
+	if err == nil && len(res.Response) != len(keys) {
+		err = fmt.Errorf("groupcache: peer returned %d values for %d keys", len(res.Response), len(keys))
+	}
+	if err != nil {
+		g.Stats.PeerErrors.Add(1)
+		return keys, err
+	}
+	for i, r := range res.Response {
+		key := keys[i]
+		if r.GetNotFound() {
+			g.Stats.NotFounds.Add(1)
+			loaded(key, ByteView{}, ErrNotFound)
+			continue
+		}
+		if r.Error != nil {
+			g.Stats.PeerErrors.Add(1)
+			failed = append(failed, key)
+			continue
+		}
+		value, err := g.peerValue(ctx, key, r)
+		if err != nil {
+			g.Stats.PeerErrors.Add(1)
+			failed = append(failed, key)
+			continue
+		}
+		g.Stats.LoadsDeduped.Add(1)
+		g.Stats.PeerLoads.Add(1)
+		loaded(key, value, nil)
+	}
+	return failed, nil
+}
+
+// load loads key either by invoking the getter locally or by sending
+// it to the machine that peers picks.
+func (g *Group) load(ctx context.Context, key string, dest Sink, peers PeerPicker) (value ByteView, destPopulated bool, err error) {
+	ctx, span := g.startSpan(ctx, "loadGroup", key)
+	defer func() { span.End(err) }()
 	viewi, err := g.loadGroup.Do(key, func() (interface{}, error) {
 		// Check the cache again because singleflight can only dedup calls
 		// that overlap concurrently.  It's possible for 2 concurrent
@@ -262,34 +730,16 @@ func (g *Group) load(ctx context.Context, key string, dest Sink) (value ByteView
 		// 1: fn()
 		// 2: loadGroup.Do("key", fn)
 		// 2: fn()
-		if value, cacheHit := g.lookupCache(key); cacheHit {
+		if value, cacheHit, err := g.lookupCache(ctx, key); cacheHit {
 			g.Stats.CacheHits.Add(1)
-			return value, nil
-		}
-		g.Stats.LoadsDeduped.Add(1)
-		var value ByteView
-		var err error
-		if peer, ok := g.peers.PickPeer(key); ok {
-			value, err = g.getFromPeer(ctx, peer, key)
-			if err == nil {
-				g.Stats.PeerLoads.Add(1)
-				return value, nil
+			if err != nil {
+				return nil, err
 			}
-			g.Stats.PeerErrors.Add(1)
-			// TODO(bradfitz): log the peer's error? keep
-			// log of the past few for /groupcachez?  It's
-			// probably boring (normal task movement), so not
-			// worth logging I imagine.
-		}
-		value, err = g.getLocally(ctx, key, dest)
-		if err != nil {
-			g.Stats.LocalLoadErrs.Add(1)
-			return nil, err
+			return value, nil
 		}
-		g.Stats.LocalLoads.Add(1)
-		destPopulated = true // only one caller of load gets this return value
-		g.populateCache(key, value, &g.mainCache)
-		return value, nil
+		var viewi interface{}
+		viewi, destPopulated, err = g.fetch(ctx, key, dest, peers)
+		return viewi, err
 	})
 	if err == nil {
 		value = viewi.(ByteView)
@@ -297,74 +747,394 @@ func (g *Group) load(ctx context.Context, key string, dest Sink) (value ByteView
 	return
 }
 
-func (g *Group) getLocally(ctx context.Context, key string, dest Sink) (ByteView, error) {
-	err := g.getter.Get(ctx, key, dest)
+// fetch loads key, which is missing from the caches, either by
+// invoking the getter locally or by sending it to the machine that
+// peers picks. It runs in the call of load that loadGroup dedups, and
+// returns the ByteView of key or an error. destPopulated reports
+// whether the getter populated dest.
+func (g *Group) fetch(ctx context.Context, key string, dest Sink, peers PeerPicker) (viewi interface{}, destPopulated bool, err error) {
+	start := time.Now()
+	g.Stats.LoadsDeduped.Add(1)
+	peerList, ownerSkipped := pickPeers(peers, key)
+	// The peers other than the owner of key take over from it, and
+	// load the key themselves rather than asking the owner again.
+	var owner ProtoGetter
+	if !ownerSkipped && len(peerList) > 0 {
+		owner = peerList[0]
+	}
+	if g.opts.HedgeDelay > 0 && len(peerList) > 0 {
+		value, err, tried, local := g.getHedged(ctx, key, peers, peerList, owner)
+		if local {
+			viewi, err = g.loadedLocally(ctx, key, start, value, err)
+			return viewi, false, err
+		}
+		if err == nil || err == ErrNotFound {
+			viewi, err = g.loadedFromPeer(key, start, value, err)
+			return viewi, false, err
+		}
+		peerList = peerList[tried:]
+	}
+	// Try the owner of key, then the peers that take over
+	// from it, so that they dedup loads while it is down.
+	for _, peer := range peerList {
+		value, err := g.getFromPeer(ctx, peer, key, peer != owner)
+		if err == nil || err == ErrNotFound {
+			viewi, err = g.loadedFromPeer(key, start, value, err)
+			return viewi, false, err
+		}
+		// getFromPeer reports the error; see
+		// RecentPeerErrors and Observer.
+		g.Stats.PeerErrors.Add(1)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	defer beginLoad(peers)()
+	value, err := g.getLocally(ctx, key, dest)
+	viewi, err = g.loadedLocally(ctx, key, start, value, err)
+	// Only one caller of load gets destPopulated.
+	return viewi, err == nil, err
+}
+
+// loadedFromPeer accounts for a value, or ErrNotFound, fetched from
+// a peer by a load of key that started at start.
+func (g *Group) loadedFromPeer(key string, start time.Time, value ByteView, err error) (interface{}, error) {
+	g.Stats.PeerLoads.Add(1)
+	g.observeLoad(key, LoadPeer, start, err)
+	if err != nil {
+		g.Stats.NotFounds.Add(1)
+		return nil, err
+	}
+	return value, nil
+}
+
+// loadedLocally accounts for the result of a local load of key by
+// a load that started at start, and caches it.
+func (g *Group) loadedLocally(ctx context.Context, key string, start time.Time, value ByteView, err error) (interface{}, error) {
+	g.observeLoad(key, LoadLocal, start, err)
+	if errors.Is(err, ErrNotFound) {
+		g.Stats.LocalLoads.Add(1)
+		g.Stats.NotFounds.Add(1)
+		g.populateNotFound(key)
+		return nil, err
+	}
+	if err != nil {
+		g.Stats.LocalLoadErrs.Add(1)
+		return nil, err
+	}
+	g.Stats.LocalLoads.Add(1)
+	g.populateCache(ctx, key, value, &g.mainCache)
+	return value, nil
+}
+
+func (g *Group) getLocally(ctx context.Context, key string, dest Sink) (value ByteView, err error) {
+	ctx, span := g.startSpan(ctx, "getLocally", key)
+	defer func() { span.End(err) }()
+	err = g.getter.Get(ctx, key, dest)
 	if err != nil {
 		return ByteView{}, err
 	}
 	return dest.view()
 }
 
-func (g *Group) getFromPeer(ctx context.Context, peer ProtoGetter, key string) (ByteView, error) {
+func (g *Group) getFromPeer(ctx context.Context, peer ProtoGetter, key string, failover bool) (value ByteView, err error) {
+	ctx, span := g.startSpan(ctx, "getFromPeer", key)
+	defer func() { span.End(err) }()
+	span.SetAttribute("groupcache.peer", peerName(peer))
 	req := &pb.GetRequest{
-		Group: &g.name,
-		Key:   &key,
+		Group:       &g.name,
+		Key:         &key,
+		AcceptCodec: g.acceptCodec(),
+	}
+	if failover {
+		req.Failover = &failover
 	}
 	res := &pb.GetResponse{}
-	err := peer.Get(ctx, req, res)
+	start := time.Now()
+	err = peer.Get(ctx, req, res)
+	g.observePeer(ctx, peer, key, start, err)
 	if err != nil {
 		return ByteView{}, err
 	}
+	if res.GetNotFound() {
+		return ByteView{}, ErrNotFound
+	}
+	return g.peerValue(ctx, key, res)
+}
+
+// peerValue returns the value of key from a peer's response, possibly
+// mirroring it in the hotCache.
+func (g *Group) peerValue(ctx context.Context, key string, res *pb.GetResponse) (ByteView, error) {
 	value := ByteView{b: res.Value}
-	// TODO(bradfitz): use res.MinuteQps or something smart to
-	// conditionally populate hotCache.  For now just do it some
-	// percentage of the time.
+	if name := res.GetCodec(); name != "" {
+		if g.opts.Codec == nil || g.opts.Codec.Name() != name {
+			return ByteView{}, fmt.Errorf("groupcache: peer sent a value encoded by unknown codec %q", name)
+		}
+		value.codec = g.opts.Codec
+	}
+	if e := res.GetExpire(); e != 0 {
+		value.e = time.Unix(0, e)
+	}
 	var pop bool
-	if g.rand != nil {
-		pop = g.rand.Intn(10) == 0
+	if res.MinuteQps != nil {
+		pop = res.GetMinuteQps() >= g.hotKeyQPS()
 	} else {
-		pop = rand.Intn(10) == 0
+		// The peer doesn't track rates; mirror the key some
+		// percentage of the time.
+		if g.rand != nil {
+			pop = g.rand.Intn(10) == 0
+		} else {
+			pop = rand.Intn(10) == 0
+		}
 	}
 	if pop {
-		g.populateCache(key, value, &g.hotCache)
+		g.populateCache(ctx, key, value, &g.hotCache)
+		if obs := g.opts.Observer; obs != nil && g.cacheBytes > 0 {
+			obs.OnHotPromote(HotPromoteEvent{
+				Group: g.name,
+				Key:   key,
+				Bytes: int64(len(key)) + valueSize(value),
+				QPS:   res.GetMinuteQps(),
+			})
+		}
 	}
 	return value, nil
 }
 
-func (g *Group) lookupCache(key string) (value ByteView, ok bool) {
+// Remove removes key from the cache of the peer that owns it, from
+// the hotCache of every other peer, and from this process's caches.
+// A peer failing to remove key doesn't stop the others: Remove returns
+// the first error, that of the owner if it failed.
+//
+// Remove does not coordinate with loads that are already in flight;
+// the caller should change the underlying data before calling Remove
+// so that a concurrent load cannot repopulate the old value.
+func (g *Group) Remove(ctx context.Context, key string) error {
+	if !g.begin() {
+		return ErrClosed
+	}
+	defer g.done()
+	g.peersOnce.Do(g.initPeers)
+
+	// Invalidate the owner first so that the other peers don't
+	// refill their hotCache from it.
+	var err error
+	owner, ok := g.peers.PickPeer(key)
+	if ok {
+		err = g.removeFromPeer(ctx, owner, key)
+	}
+
+	if lister, ok := g.peers.(PeerLister); ok {
+		var (
+			wg   sync.WaitGroup
+			errc = make(chan error, 1)
+		)
+		for _, peer := range lister.ListPeers() {
+			if peer == nil || peer == owner {
+				continue
+			}
+			wg.Add(1)
+			go func(peer ProtoGetter) {
+				defer wg.Done()
+				if err := g.removeFromPeer(ctx, peer, key); err != nil {
+					select {
+					case errc <- err:
+					default:
+					}
+				}
+			}(peer)
+		}
+		wg.Wait()
+		select {
+		case perr := <-errc:
+			if err == nil {
+				err = perr
+			}
+		default:
+		}
+	}
+
+	g.localRemove(key)
+	return err
+}
+
+func (g *Group) removeFromPeer(ctx context.Context, peer ProtoGetter, key string) error {
+	remover, ok := peer.(ProtoRemover)
+	if !ok {
+		return errors.New("groupcache: peer does not support Remove")
+	}
+	req := &pb.RemoveRequest{
+		Group: &g.name,
+		Key:   &key,
+	}
+	return remover.Remove(ctx, req, &pb.RemoveResponse{})
+}
+
+// Set stores value in the mainCache of the peer that owns key, so
+// that later Gets find it without loading it.
+//
+// Set does not update copies of key held in the hotCache of other
+// peers; call Remove first if they may hold an older value.
+func (g *Group) Set(ctx context.Context, key string, value []byte) error {
+	return g.SetOpts(ctx, key, value, nil)
+}
+
+// SetOptions are the options of SetOpts.
+type SetOptions struct {
+	// Expire, if non-zero, is the time at which the value expires.
+	Expire time.Time
+
+	// HotCache specifies that if key is owned by another peer, the
+	// value is also stored in this process's hotCache.
+	HotCache bool
+}
+
+// SetOpts is like Set, but stores the value with the given options.
+func (g *Group) SetOpts(ctx context.Context, key string, value []byte, o *SetOptions) error {
+	if o == nil {
+		o = &SetOptions{}
+	}
+	if !g.begin() {
+		return ErrClosed
+	}
+	defer g.done()
+	g.peersOnce.Do(g.initPeers)
+	view := ByteView{b: cloneBytes(value), e: o.Expire}
+	peer, ok := g.peers.PickPeer(key)
+	if !ok {
+		g.localSet(ctx, key, view)
+		return nil
+	}
+	if err := g.setOnPeer(ctx, peer, key, view); err != nil {
+		return err
+	}
+	if o.HotCache {
+		g.populateCache(ctx, key, view, &g.hotCache)
+	} else if g.cacheBytes > 0 {
+		g.hotCache.remove(key)
+	}
+	return nil
+}
+
+func (g *Group) setOnPeer(ctx context.Context, peer ProtoGetter, key string, value ByteView) error {
+	setter, ok := peer.(ProtoSetter)
+	if !ok {
+		return errors.New("groupcache: peer does not support Set")
+	}
+	req := &pb.SetRequest{
+		Group: &g.name,
+		Key:   &key,
+		Value: value.ByteSlice(),
+	}
+	if !value.e.IsZero() {
+		e := value.e.UnixNano()
+		req.Expire = &e
+	}
+	return setter.Set(ctx, req, &pb.SetResponse{})
+}
+
+// localSet stores value for key in this process's mainCache.
+func (g *Group) localSet(ctx context.Context, key string, value ByteView) {
 	if g.cacheBytes <= 0 {
 		return
 	}
-	value, ok = g.mainCache.get(key)
+	g.hotCache.remove(key)
+	g.populateCache(ctx, key, value, &g.mainCache)
+}
+
+// localRemove removes key from this process's caches only.
+func (g *Group) localRemove(key string) {
+	if g.cacheBytes <= 0 {
+		return
+	}
+	g.mainCache.remove(key)
+	g.hotCache.remove(key)
+}
+
+func (g *Group) hotKeyQPS() float64 {
+	if g.opts.HotKeyQPS == 0 {
+		return defaultHotKeyQPS
+	}
+	return g.opts.HotKeyQPS
+}
+
+// minuteQPS returns the rate at which key was read from the mainCache
+// over the last minute, for peers deciding whether to mirror it.
+func (g *Group) minuteQPS(key string) float64 {
+	if g.cacheBytes <= 0 {
+		return 0
+	}
+	return g.mainCache.minuteQPS(key)
+}
+
+// lookupCache returns the cached value of key. If ok is true and err
+// is ErrNotFound, the cache remembers that key has no value.
+func (g *Group) lookupCache(ctx context.Context, key string) (value ByteView, ok bool, err error) {
+	if g.cacheBytes <= 0 {
+		return
+	}
+	_, span := g.startSpan(ctx, "lookupCache", key)
+	defer func() {
+		span.SetAttribute("groupcache.hit", strconv.FormatBool(ok))
+		span.End(nil)
+	}()
+	value, ok, err = g.mainCache.get(key)
 	if ok {
+		if err != nil {
+			g.Stats.NotFounds.Add(1)
+		}
 		return
 	}
-	value, ok = g.hotCache.get(key)
+	value, ok, err = g.hotCache.get(key)
 	return
 }
 
-func (g *Group) populateCache(key string, value ByteView, cache *cache) {
+func (g *Group) populateCache(ctx context.Context, key string, value ByteView, cache *cache) {
 	if g.cacheBytes <= 0 {
 		return
 	}
-	cache.add(key, value)
+	_, span := g.startSpan(ctx, "populateCache", key)
+	defer span.End(nil)
+	which := MainCache
+	if cache == &g.hotCache {
+		which = HotCache
+	}
+	span.SetAttribute("groupcache.cache", which.String())
+	cache.add(key, value.encode(g.opts.Codec))
+	g.evict()
+}
 
-	// Evict items from cache(s) if necessary.
+// populateNotFound records in the mainCache that key has no value,
+// if the group is configured to do so.
+func (g *Group) populateNotFound(key string) {
+	if g.cacheBytes <= 0 || g.opts.NotFoundExpiry <= 0 {
+		return
+	}
+	g.mainCache.addNotFound(key, timeNow().Add(g.opts.NotFoundExpiry))
+	g.evict()
+}
+
+// evict evicts items from the caches until they fit in cacheBytes, as
+// divided by the group's CacheSplit.
+func (g *Group) evict() {
+	split := g.opts.CacheSplit
+	if split == nil {
+		split = defaultSplit{}
+	}
 	for {
-		mainBytes := g.mainCache.bytes()
-		hotBytes := g.hotCache.bytes()
-		if mainBytes+hotBytes <= g.cacheBytes {
+		var victim *cache
+		switch split.Victim(g.cacheBytes, g.mainCache.stats(), g.hotCache.stats()) {
+		case MainCache:
+			victim = &g.mainCache
+		case HotCache:
+			victim = &g.hotCache
+		default:
 			return
 		}
-
-		// TODO(bradfitz): this is good-enough-for-now logic.
-		// It should be something based on measurements and/or
-		// respecting the costs of different resources.
-		victim := &g.mainCache
-		if hotBytes > mainBytes/8 {
-			victim = &g.hotCache
+		if victim.items() == 0 {
+			return
 		}
-		victim.removeOldest()
+		victim.evict()
 	}
 }
 
@@ -382,6 +1152,34 @@ const (
 	HotCache
 )
 
+func (c CacheType) String() string {
+	switch c {
+	case MainCache:
+		return "main"
+	case HotCache:
+		return "hot"
+	}
+	return "CacheType(" + strconv.Itoa(int(c)) + ")"
+}
+
+// MarshalText encodes c as its String.
+func (c CacheType) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText decodes c from its String.
+func (c *CacheType) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "main":
+		*c = MainCache
+	case "hot":
+		*c = HotCache
+	default:
+		return fmt.Errorf("groupcache: unknown cache type %q", b)
+	}
+	return nil
+}
+
 // CacheStats returns stats about the provided cache within the group.
 func (g *Group) CacheStats(which CacheType) CacheStats {
 	switch which {
@@ -394,17 +1192,75 @@ func (g *Group) CacheStats(which CacheType) CacheStats {
 	}
 }
 
-// cache is a wrapper around an *lru.Cache that adds synchronization,
-// makes values always be ByteView, and counts the size of all keys and
-// values.
+// PolicyStats returns the counters specific to the EvictionPolicy of
+// one of the group's caches; see EvictionPolicy.Stats. It may return
+// nil.
+func (g *Group) PolicyStats(which CacheType) map[string]int64 {
+	switch which {
+	case MainCache:
+		return g.mainCache.policyStats()
+	case HotCache:
+		return g.hotCache.policyStats()
+	default:
+		return nil
+	}
+}
+
+// A HotKey is a key that is read often from a cache.
+type HotKey struct {
+	Key   string
+	QPS   float64 // reads per second over the last minute
+	Cache CacheType
+}
+
+// HotKeys returns up to n of the keys most read from g's caches, most
+// read first. The keys are tracked approximately, as they are read.
+func (g *Group) HotKeys(n int) []HotKey {
+	keys := append(g.mainCache.hotKeys(n, MainCache), g.hotCache.hotKeys(n, HotCache)...)
+	sort.Slice(keys, func(i, j int) bool { return keys[i].QPS > keys[j].QPS })
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// InFlight returns the keys being loaded by g, sorted.
+func (g *Group) InFlight() []string {
+	lg, ok := g.loadGroup.(interface{ Keys() []string })
+	if !ok {
+		return nil
+	}
+	keys := lg.Keys()
+	sort.Strings(keys)
+	return keys
+}
+
+// cache is a wrapper around an EvictionPolicy that adds
+// synchronization, makes values always be ByteView or notFound, counts
+// the size of all keys and values, and tracks the rate at which each
+// key is read.
 type cache struct {
 	mu         sync.RWMutex
-	nbytes     int64 // of all keys and values
-	lru        *lru.Cache
+	nbytes     int64      // of all keys and values
+	newPolicy  PolicyFunc // nil means NewLRUPolicy
+	policy     EvictionPolicy
 	nhit, nget int64
 	nevict     int64 // number of evictions
+	removing   bool  // the policy is removing an entry, not evicting it
+
+	// onEvict, if not nil, is called with the size of each entry
+	// that leaves the cache, with mu held.
+	onEvict func(key string, bytes int64)
+
+	// top holds the most read keys, approximately, for hotKeys.
+	// A key read more often than topMin may displace one of them.
+	top    map[string]*cacheEntry
+	topMin rate
 }
 
+// maxTopKeys is the number of most read keys that a cache tracks.
+const maxTopKeys = 32
+
 func (c *cache) stats() CacheStats {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -417,43 +1273,237 @@ func (c *cache) stats() CacheStats {
 	}
 }
 
+// policyStats returns the counters of the cache's EvictionPolicy.
+func (c *cache) policyStats() map[string]int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.policy == nil {
+		return nil
+	}
+	return c.policy.Stats()
+}
+
+// notFound is stored in a cache in place of a ByteView to remember
+// that the Getter returned ErrNotFound for the key, until e.
+type notFound struct {
+	e time.Time
+}
+
+// A cacheEntry is the value stored in a cache's EvictionPolicy.
+type cacheEntry struct {
+	value interface{} // ByteView or notFound
+	rate  rate        // of gets of the key
+}
+
+// rate estimates the rate of events over the last minute by
+// exponentially decaying a count of events.
+type rate struct {
+	count float64
+	last  time.Time
+}
+
+const rateWindow = time.Minute
+
+func (r *rate) decayed(now time.Time) float64 {
+	if r.count == 0 {
+		return 0
+	}
+	return r.count * math.Exp(-float64(now.Sub(r.last))/float64(rateWindow))
+}
+
+// add records an event at now.
+func (r *rate) add(now time.Time) {
+	r.count = r.decayed(now) + 1
+	r.last = now
+}
+
+// perSecond returns the rate of events as of now, in events per second.
+func (r *rate) perSecond(now time.Time) float64 {
+	return r.decayed(now) / rateWindow.Seconds()
+}
+
+// valueSize returns the number of bytes accounted for a cached value.
+func valueSize(value interface{}) int64 {
+	if v, ok := value.(ByteView); ok {
+		return int64(v.Len())
+	}
+	return 0
+}
+
 func (c *cache) add(key string, value ByteView) {
+	c.addValue(key, value)
+}
+
+func (c *cache) addNotFound(key string, e time.Time) {
+	c.addValue(key, notFound{e: e})
+}
+
+func (c *cache) addValue(key string, value interface{}) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru == nil {
-		c.lru = &lru.Cache{
-			OnEvicted: func(key lru.Key, value interface{}) {
-				val := value.(ByteView)
-				c.nbytes -= int64(len(key.(string))) + int64(val.Len())
-				c.nevict++
-			},
+	if c.policy == nil {
+		newPolicy := c.newPolicy
+		if newPolicy == nil {
+			newPolicy = NewLRUPolicy
 		}
+		c.policy = newPolicy(func(key string, value interface{}) {
+			size := int64(len(key)) + valueSize(value.(*cacheEntry).value)
+			c.nbytes -= size
+			if !c.removing {
+				c.nevict++
+			}
+			delete(c.top, key)
+			if c.onEvict != nil {
+				c.onEvict(key, size)
+			}
+		})
+	}
+	if ei, ok := c.policy.Peek(key); ok {
+		// Replace the old value, keeping the key's rate.
+		e := ei.(*cacheEntry)
+		c.nbytes += valueSize(value) - valueSize(e.value)
+		e.value = value
+		return
 	}
-	c.lru.Add(key, value)
-	c.nbytes += int64(len(key)) + int64(value.Len())
+	e := &cacheEntry{value: value}
+	e.rate.add(timeNow())
+	c.policy.Add(key, e)
+	c.nbytes += int64(len(key)) + valueSize(value)
 }
 
-func (c *cache) get(key string) (value ByteView, ok bool) {
+// get returns the cached value of key. If ok is true and err is
+// ErrNotFound, key was cached with addNotFound.
+func (c *cache) get(key string) (value ByteView, ok bool, err error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.nget++
-	if c.lru == nil {
+	if c.policy == nil {
 		return
 	}
-	vi, ok := c.lru.Get(key)
+	ei, ok := c.policy.Get(key)
 	if !ok {
 		return
 	}
+	e := ei.(*cacheEntry)
+	now := timeNow()
+	switch v := e.value.(type) {
+	case ByteView:
+		if v.expired(now) {
+			c.removeLocked(key)
+			return ByteView{}, false, nil
+		}
+		value = v
+	case notFound:
+		if !now.Before(v.e) {
+			c.removeLocked(key)
+			return ByteView{}, false, nil
+		}
+		err = ErrNotFound
+	}
+	e.rate.add(now)
+	c.noteTop(key, e, now)
 	c.nhit++
-	return vi.(ByteView), true
+	return value, true, err
 }
 
-func (c *cache) removeOldest() {
+// noteTop lets key, just read, displace the least read of the top
+// keys if it is read more often. c.mu must be held.
+func (c *cache) noteTop(key string, e *cacheEntry, now time.Time) {
+	if _, ok := c.top[key]; ok {
+		return
+	}
+	if c.top == nil {
+		c.top = make(map[string]*cacheEntry, maxTopKeys)
+	}
+	if len(c.top) < maxTopKeys {
+		c.top[key] = e
+		return
+	}
+	if e.rate.count <= c.topMin.decayed(now) {
+		return
+	}
+	minKey, min, next := "", math.Inf(1), math.Inf(1)
+	for k, te := range c.top {
+		r := te.rate.decayed(now)
+		if r < min {
+			minKey, min, next = k, r, min
+		} else if r < next {
+			next = r
+		}
+	}
+	if e.rate.count > min {
+		delete(c.top, minKey)
+		c.top[key] = e
+		min = math.Min(next, e.rate.count)
+	}
+	c.topMin = rate{count: min, last: now}
+}
+
+// hotKeys returns up to n of the most read keys, most read first.
+func (c *cache) hotKeys(n int, which CacheType) []HotKey {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru != nil {
-		c.lru.RemoveOldest()
+	now := timeNow()
+	keys := make([]HotKey, 0, len(c.top))
+	for key, e := range c.top {
+		keys = append(keys, HotKey{Key: key, QPS: e.rate.perSecond(now), Cache: which})
 	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].QPS > keys[j].QPS })
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// minuteQPS returns the rate at which key was read from the cache
+// over the last minute, in queries per second.
+func (c *cache) minuteQPS(key string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.policy == nil {
+		return 0
+	}
+	ei, ok := c.policy.Peek(key)
+	if !ok {
+		return 0
+	}
+	return ei.(*cacheEntry).rate.perSecond(timeNow())
+}
+
+func (c *cache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.policy != nil {
+		c.removeLocked(key)
+	}
+	delete(c.top, key)
+}
+
+// removeLocked removes key from the policy without counting it as an
+// eviction. c.mu must be held.
+func (c *cache) removeLocked(key string) {
+	c.removing = true
+	c.policy.Remove(key)
+	c.removing = false
+}
+
+// evict removes the entry chosen by the cache's policy.
+func (c *cache) evict() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.policy != nil {
+		c.policy.Evict()
+	}
+}
+
+// clear removes all items from the cache, without counting them
+// as evictions.
+func (c *cache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.policy = nil
+	c.nbytes = 0
+	c.top = nil
 }
 
 func (c *cache) bytes() int64 {
@@ -469,12 +1519,15 @@ func (c *cache) items() int64 {
 }
 
 func (c *cache) itemsLocked() int64 {
-	if c.lru == nil {
+	if c.policy == nil {
 		return 0
 	}
-	return int64(c.lru.Len())
+	return int64(c.policy.Len())
 }
 
+// timeNow returns the current time. It is replaced when testing.
+var timeNow = time.Now
+
 // An AtomicInt is an int64 to be accessed atomically.
 type AtomicInt int64
 
@@ -498,5 +1551,5 @@ type CacheStats struct {
 	Items     int64
 	Gets      int64
 	Hits      int64
-	Evictions int64
+	Evictions int64 // to make room; keys removed or expired aren't counted
 }
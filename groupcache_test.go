@@ -19,13 +19,17 @@ limitations under the License.
 package groupcache
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
 	"hash/crc32"
 	"math/rand"
 	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 	"unsafe"
@@ -33,6 +37,7 @@ import (
 	"github.com/golang/protobuf/proto"
 
 	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/groupcache/singleflight"
 	testpb "github.com/golang/groupcache/testpb"
 )
 
@@ -227,8 +232,11 @@ func TestCacheEviction(t *testing.T) {
 }
 
 type fakePeer struct {
-	hits int
-	fail bool
+	hits    int
+	batches int
+	removes int
+	sets    map[string]string
+	fail    bool
 }
 
 func (p *fakePeer) Get(_ context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
@@ -240,6 +248,36 @@ func (p *fakePeer) Get(_ context.Context, in *pb.GetRequest, out *pb.GetResponse
 	return nil
 }
 
+func (p *fakePeer) GetMulti(_ context.Context, in *pb.GetMultiRequest, out *pb.GetMultiResponse) error {
+	p.batches++
+	if p.fail {
+		return errors.New("simulated error from peer")
+	}
+	for _, key := range in.GetKey() {
+		out.Response = append(out.Response, &pb.GetResponse{Value: []byte("got:" + key)})
+	}
+	return nil
+}
+
+func (p *fakePeer) Remove(_ context.Context, in *pb.RemoveRequest, out *pb.RemoveResponse) error {
+	p.removes++
+	if p.fail {
+		return errors.New("simulated error from peer")
+	}
+	return nil
+}
+
+func (p *fakePeer) Set(_ context.Context, in *pb.SetRequest, out *pb.SetResponse) error {
+	if p.fail {
+		return errors.New("simulated error from peer")
+	}
+	if p.sets == nil {
+		p.sets = make(map[string]string)
+	}
+	p.sets[in.GetKey()] = string(in.GetValue())
+	return nil
+}
+
 type fakePeers []ProtoGetter
 
 func (p fakePeers) PickPeer(key string) (peer ProtoGetter, ok bool) {
@@ -263,7 +301,7 @@ func TestPeers(t *testing.T) {
 		localHits++
 		return dest.SetString("got:" + key)
 	}
-	testGroup := newGroup("TestPeers-group", cacheSize, GetterFunc(getter), peerList)
+	testGroup := newGroup("TestPeers-group", cacheSize, GetterFunc(getter), peerList, nil)
 	testGroup.rand = rand.New(rand.NewSource(123))
 	run := func(name string, n int, wantSummary string) {
 		// Reset counters
@@ -322,6 +360,1051 @@ func TestPeers(t *testing.T) {
 	run("peer0_failing", 200, "localHits = 100, peers = 51 49 51")
 }
 
+func (p fakePeers) ListPeers() []ProtoGetter {
+	return p
+}
+
+func TestRemove(t *testing.T) {
+	peer0 := &fakePeer{}
+	peer1 := &fakePeer{}
+	peerList := fakePeers([]ProtoGetter{peer0, peer1, nil})
+	localHits := 0
+	getter := func(_ context.Context, key string, dest Sink) error {
+		localHits++
+		return dest.SetString("got:" + key)
+	}
+	g := newGroup("TestRemove-group", 1<<20, GetterFunc(getter), peerList, nil)
+
+	// Find a key owned by this process so that it lands in mainCache.
+	var key string
+	for i := 0; ; i++ {
+		key = fmt.Sprintf("key-%d", i)
+		if _, ok := peerList.PickPeer(key); !ok {
+			break
+		}
+	}
+	var s string
+	for i := 0; i < 2; i++ {
+		if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if localHits != 1 {
+		t.Fatalf("localHits = %d before Remove; want 1", localHits)
+	}
+
+	if err := g.Remove(dummyCtx, key); err != nil {
+		t.Fatal(err)
+	}
+	if peer0.removes != 1 || peer1.removes != 1 {
+		t.Errorf("peer removes = %d %d; want 1 1", peer0.removes, peer1.removes)
+	}
+	if n := g.CacheStats(MainCache).Evictions; n != 0 {
+		t.Errorf("Evictions = %d after Remove; want 0", n)
+	}
+	if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if localHits != 2 {
+		t.Errorf("localHits = %d after Remove; want 2", localHits)
+	}
+
+	// A key owned by a failing peer reports the owner's error.
+	peer0.fail = true
+	for i := 0; ; i++ {
+		key = fmt.Sprintf("key-%d", i)
+		if peer, _ := peerList.PickPeer(key); peer == peer0 {
+			break
+		}
+	}
+	g.mainCache.add(key, ByteView{s: "stale"})
+	if err := g.Remove(dummyCtx, key); err == nil {
+		t.Error("Remove with failing owner succeeded; want error")
+	}
+	// The other peers and this process remove key all the same.
+	if _, ok, _ := g.mainCache.get(key); ok || peer1.removes != 2 {
+		t.Errorf("after Remove with failing owner, key cached %v and peer1 removes = %d; want false and 2", ok, peer1.removes)
+	}
+}
+
+func TestSet(t *testing.T) {
+	peer0 := &fakePeer{}
+	peerList := fakePeers([]ProtoGetter{peer0, nil})
+	localHits := 0
+	getter := func(_ context.Context, key string, dest Sink) error {
+		localHits++
+		return dest.SetString("got:" + key)
+	}
+	g := newGroup("TestSet-group", 1<<20, GetterFunc(getter), peerList, nil)
+
+	var localKey, remoteKey string
+	for i := 0; localKey == "" || remoteKey == ""; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if _, ok := peerList.PickPeer(key); ok {
+			remoteKey = key
+		} else {
+			localKey = key
+		}
+	}
+
+	// A key owned by this process is stored in mainCache.
+	if err := g.Set(dummyCtx, localKey, []byte("set:"+localKey)); err != nil {
+		t.Fatal(err)
+	}
+	var s string
+	if err := g.Get(dummyCtx, localKey, StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if want := "set:" + localKey; s != want {
+		t.Errorf("Get(%q) = %q; want %q", localKey, s, want)
+	}
+	if localHits != 0 {
+		t.Errorf("localHits = %d; want 0", localHits)
+	}
+
+	// Setting it again replaces the value without leaking bytes.
+	if err := g.Set(dummyCtx, localKey, []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := g.mainCache.bytes(), int64(len(localKey)+1); got != want {
+		t.Errorf("mainCache bytes = %d; want %d", got, want)
+	}
+
+	expire := time.Now().Add(time.Hour).Round(0)
+	if err := g.SetOpts(dummyCtx, localKey, []byte("x"), &SetOptions{Expire: expire}); err != nil {
+		t.Fatal(err)
+	}
+	if v, _, _ := g.mainCache.get(localKey); !v.Expire().Equal(expire) {
+		t.Errorf("expiry after SetOpts = %v; want %v", v.Expire(), expire)
+	}
+
+	// A key owned by a peer is sent to it and optionally kept hot.
+	if err := g.SetOpts(dummyCtx, remoteKey, []byte("set:"+remoteKey), &SetOptions{HotCache: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := peer0.sets[remoteKey], "set:"+remoteKey; got != want {
+		t.Errorf("peer value for %q = %q; want %q", remoteKey, got, want)
+	}
+	if err := g.Get(dummyCtx, remoteKey, StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if want := "set:" + remoteKey; s != want {
+		t.Errorf("Get(%q) = %q; want %q", remoteKey, s, want)
+	}
+	if peer0.hits != 0 {
+		t.Errorf("peer hits = %d; want 0", peer0.hits)
+	}
+}
+
+func TestGetMulti(t *testing.T) {
+	peer0 := &fakePeer{}
+	peer1 := &fakePeer{}
+	peer2 := &expirePeer{} // doesn't support GetMulti
+	peerList := fakePeers([]ProtoGetter{peer0, peer1, peer2, nil})
+	var localHits AtomicInt
+	getter := func(_ context.Context, key string, dest Sink) error {
+		localHits.Add(1)
+		return dest.SetString("got:" + key)
+	}
+	g := newGroup("TestGetMulti-group", 1<<20, GetterFunc(getter), peerList, nil)
+
+	run := func(name string, keys []string) {
+		values := make(map[string]*string)
+		err := g.GetMulti(dummyCtx, keys, func(key string) Sink {
+			if _, dup := values[key]; dup {
+				t.Errorf("%s: dest called twice for %q", name, key)
+			}
+			values[key] = new(string)
+			return StringSink(values[key])
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, key := range keys {
+			if got, want := *values[key], "got:"+key; got != want {
+				t.Errorf("%s: for key %q, got %q; want %q", name, key, got, want)
+			}
+		}
+	}
+
+	keys := testKeys(100)
+	run("base", append(keys, keys[0]))
+	if peer0.batches != 1 || peer1.batches != 1 {
+		t.Errorf("peer batches = %d %d; want 1 1", peer0.batches, peer1.batches)
+	}
+	if localHits.Get() == 0 {
+		t.Error("no keys were loaded locally")
+	}
+
+	// The keys of a failing peer are loaded locally.
+	peer0.fail = true
+	localHits = 0
+	keys = testKeys(200)[100:]
+	run("peer0_failing", keys)
+	var want int64
+	for _, key := range keys {
+		if peer, _ := peerList.PickPeer(key); peer == nil || peer == peer0 {
+			want++
+		}
+	}
+	if got := localHits.Get(); got != want {
+		t.Errorf("localHits = %d; want %d", got, want)
+	}
+}
+
+// blockingPeer answers requests once release is closed.
+type blockingPeer struct {
+	mu      sync.Mutex
+	gets    []string
+	batches [][]string
+	release chan bool
+}
+
+func (p *blockingPeer) Get(_ context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	p.mu.Lock()
+	p.gets = append(p.gets, in.GetKey())
+	p.mu.Unlock()
+	<-p.release
+	out.Value = []byte("got:" + in.GetKey())
+	return nil
+}
+
+func (p *blockingPeer) GetMulti(_ context.Context, in *pb.GetMultiRequest, out *pb.GetMultiResponse) error {
+	p.mu.Lock()
+	p.batches = append(p.batches, in.GetKey())
+	p.mu.Unlock()
+	<-p.release
+	for _, key := range in.GetKey() {
+		out.Response = append(out.Response, &pb.GetResponse{Value: []byte("got:" + key)})
+	}
+	return nil
+}
+
+// requests returns the keys of the Gets and of the batches so far.
+func (p *blockingPeer) requests() (gets []string, batches [][]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append(gets, p.gets...), append(batches, p.batches...)
+}
+
+// joinFlightGroup is a singleflight.Group that sends the key of each
+// Do to joins.
+type joinFlightGroup struct {
+	singleflight.Group
+	joins chan string
+}
+
+func (g *joinFlightGroup) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	g.joins <- key
+	return g.Group.Do(key, fn)
+}
+
+// TestGetMultiDedup tests that Get and GetMulti load a key once when
+// they overlap.
+func TestGetMultiDedup(t *testing.T) {
+	setup := func(name string) (*Group, *blockingPeer, *joinFlightGroup) {
+		peer := &blockingPeer{release: make(chan bool)}
+		g := newGroup(name, 0, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+			return errors.New("unexpected local load")
+		}), fakePeers{peer}, nil)
+		fg := &joinFlightGroup{joins: make(chan string, 10)}
+		g.loadGroup = fg
+		return g, peer, fg
+	}
+	values := map[string]*string{"j": new(string), "k": new(string)}
+	dest := func(key string) Sink { return StringSink(values[key]) }
+
+	// A GetMulti waits for the Get in flight.
+	g, peer, fg := setup("TestGetMultiDedup-get")
+	got := make(chan string)
+	go func() {
+		var s string
+		if err := g.Get(dummyCtx, "k", StringSink(&s)); err != nil {
+			t.Error(err)
+		}
+		got <- s
+	}()
+	<-fg.joins
+	multiErr := make(chan error)
+	go func() { multiErr <- g.GetMulti(dummyCtx, []string{"j", "k"}, dest) }()
+	if key := <-fg.joins; key != "k" {
+		t.Fatalf("GetMulti joined the load of %q; want k", key)
+	}
+	close(peer.release)
+	if err := <-multiErr; err != nil {
+		t.Fatal(err)
+	}
+	if s := <-got; s != "got:k" || *values["k"] != "got:k" || *values["j"] != "got:j" {
+		t.Errorf("Get = %q, GetMulti = %q, %q", s, *values["j"], *values["k"])
+	}
+	gets, batches := peer.requests()
+	if !reflect.DeepEqual(gets, []string{"k"}) || !reflect.DeepEqual(batches, [][]string{{"j"}}) {
+		t.Errorf("peer got Gets %q and batches %q; want [k] and [[j]]", gets, batches)
+	}
+
+	// A Get waits for the batch in flight.
+	g, peer, fg = setup("TestGetMultiDedup-batch")
+	go func() { multiErr <- g.GetMulti(dummyCtx, []string{"k"}, dest) }()
+	for {
+		if _, batches := peer.requests(); len(batches) > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	go func() {
+		var s string
+		if err := g.Get(dummyCtx, "k", StringSink(&s)); err != nil {
+			t.Error(err)
+		}
+		got <- s
+	}()
+	<-fg.joins
+	close(peer.release)
+	if err := <-multiErr; err != nil {
+		t.Fatal(err)
+	}
+	if s := <-got; s != "got:k" {
+		t.Errorf("Get = %q; want got:k", s)
+	}
+	if gets, _ := peer.requests(); len(gets) != 0 {
+		t.Errorf("peer got Gets %q; want none", gets)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	now := time.Unix(1000, 0)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	fills := 0
+	g := newGroup("TestExpire-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		fills++
+		dest.SetExpire(now.Add(time.Minute))
+		return dest.SetString("value:" + key)
+	}), NoPeers{}, nil)
+
+	get := func() ByteView {
+		var v ByteView
+		if err := g.Get(dummyCtx, "k", ByteViewSink(&v)); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	if v, want := get(), now.Add(time.Minute); !v.Expire().Equal(want) {
+		t.Errorf("Expire() = %v; want %v", v.Expire(), want)
+	}
+	get()
+	if fills != 1 {
+		t.Errorf("fills = %d before expiration; want 1", fills)
+	}
+
+	now = now.Add(time.Minute)
+	get()
+	if fills != 2 {
+		t.Errorf("fills = %d after expiration; want 2", fills)
+	}
+}
+
+func TestExpireFromPeer(t *testing.T) {
+	expire := time.Unix(2000, 0)
+	peer := &expirePeer{expire: expire}
+	g := newGroup("TestExpireFromPeer-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return errors.New("unexpected local load")
+	}), fakePeers([]ProtoGetter{peer}), nil)
+
+	var s string
+	sink := StringSink(&s)
+	if err := g.Get(dummyCtx, "k", sink); err != nil {
+		t.Fatal(err)
+	}
+	v, _ := sink.view()
+	if !v.Expire().Equal(expire) {
+		t.Errorf("Expire() = %v; want %v", v.Expire(), expire)
+	}
+}
+
+type expirePeer struct {
+	expire time.Time
+}
+
+func (p *expirePeer) Get(_ context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	out.Value = []byte("got:" + in.GetKey())
+	if !p.expire.IsZero() {
+		out.Expire = proto.Int64(p.expire.UnixNano())
+	}
+	return nil
+}
+
+func TestNotFound(t *testing.T) {
+	now := time.Unix(1000, 0)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	fills := 0
+	g := newGroup("TestNotFound-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		fills++
+		return ErrNotFound
+	}), NoPeers{}, &GroupOptions{NotFoundExpiry: time.Minute})
+
+	get := func() {
+		var s string
+		if err := g.Get(dummyCtx, "missing", StringSink(&s)); err != ErrNotFound {
+			t.Fatalf("Get error = %v; want ErrNotFound", err)
+		}
+	}
+	get()
+	get()
+	if fills != 1 {
+		t.Errorf("fills = %d before expiration; want 1", fills)
+	}
+	if got := g.Stats.NotFounds.Get(); got != 2 {
+		t.Errorf("Stats.NotFounds = %d; want 2", got)
+	}
+	if got := g.Stats.LocalLoadErrs.Get(); got != 0 {
+		t.Errorf("Stats.LocalLoadErrs = %d; want 0", got)
+	}
+	if got, want := g.mainCache.bytes(), int64(len("missing")); got != want {
+		t.Errorf("mainCache bytes = %d; want %d", got, want)
+	}
+
+	now = now.Add(time.Minute)
+	get()
+	if fills != 2 {
+		t.Errorf("fills = %d after expiration; want 2", fills)
+	}
+}
+
+func TestNotFoundFromPeer(t *testing.T) {
+	g := newGroup("TestNotFoundFromPeer-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return errors.New("unexpected local load")
+	}), fakePeers([]ProtoGetter{notFoundPeer{}}), nil)
+
+	var s string
+	if err := g.Get(dummyCtx, "k", StringSink(&s)); err != ErrNotFound {
+		t.Errorf("Get error = %v; want ErrNotFound", err)
+	}
+	if got := g.Stats.PeerErrors.Get(); got != 0 {
+		t.Errorf("Stats.PeerErrors = %d; want 0", got)
+	}
+}
+
+type notFoundPeer struct{}
+
+func (notFoundPeer) Get(_ context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	out.NotFound = proto.Bool(true)
+	return nil
+}
+
+type qpsPeer struct {
+	qps float64
+}
+
+func (p *qpsPeer) Get(_ context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	out.Value = []byte("got:" + in.GetKey())
+	out.MinuteQps = proto.Float64(p.qps)
+	return nil
+}
+
+func TestHotKeyQPS(t *testing.T) {
+	peer := &qpsPeer{}
+	g := newGroup("TestHotKeyQPS-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return errors.New("unexpected local load")
+	}), fakePeers([]ProtoGetter{peer}), &GroupOptions{HotKeyQPS: 5})
+
+	var s string
+	for i := 0; i < 10; i++ {
+		if err := g.Get(dummyCtx, fmt.Sprintf("cold-%d", i), StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := g.hotCache.items(); n != 0 {
+		t.Errorf("hotCache has %d items after cold keys; want 0", n)
+	}
+
+	peer.qps = 5
+	if err := g.Get(dummyCtx, "hot", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if n := g.hotCache.items(); n != 1 {
+		t.Errorf("hotCache has %d items after hot key; want 1", n)
+	}
+}
+
+func TestRate(t *testing.T) {
+	now := time.Unix(1000, 0)
+	var r rate
+	if got := r.perSecond(now); got != 0 {
+		t.Errorf("initial rate = %v; want 0", got)
+	}
+	// A steady 2 events per second converges on 2 qps.
+	for i := 0; i < 2*600; i++ {
+		now = now.Add(500 * time.Millisecond)
+		r.add(now)
+	}
+	if got := r.perSecond(now); got < 1.9 || got > 2.1 {
+		t.Errorf("rate after steady load = %v; want about 2", got)
+	}
+	// And decays once the events stop.
+	if got := r.perSecond(now.Add(10 * time.Minute)); got > 0.01 {
+		t.Errorf("rate after 10 idle minutes = %v; want about 0", got)
+	}
+}
+
+// usePolicy is an LRU policy that counts the uses of keys.
+type usePolicy struct {
+	EvictionPolicy
+	uses int
+}
+
+func (p *usePolicy) Get(key string) (interface{}, bool) {
+	p.uses++
+	return p.EvictionPolicy.Get(key)
+}
+
+func TestCachePeek(t *testing.T) {
+	p := new(usePolicy)
+	c := &cache{newPolicy: func(onEvicted func(string, interface{})) EvictionPolicy {
+		p.EvictionPolicy = NewLRUPolicy(onEvicted)
+		return p
+	}}
+	c.add("k", ByteView{s: "v1"})
+	c.add("k", ByteView{s: "v2"})
+	c.minuteQPS("k")
+	if p.uses != 0 {
+		t.Errorf("replacing a value and reading its rate used the key %d times; want 0", p.uses)
+	}
+	if _, ok, _ := c.get("k"); !ok || p.uses != 1 {
+		t.Errorf("get used the key %d times; want 1", p.uses)
+	}
+}
+
+func TestEvictionPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   PolicyFunc
+		keepsHot bool
+	}{
+		{"LRU", nil, false},
+		{"LFU", NewLFUPolicy, true},
+		{"TinyLFU", NewTinyLFUPolicy, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loads := map[string]int{}
+			r := NewRegistry()
+			// Room for 10 entries of a 3-byte key and value each.
+			g := r.NewGroupOpts("TestEvictionPolicy-group", 60, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+				loads[key]++
+				return dest.SetString(key)
+			}), &GroupOptions{EvictionPolicy: tt.policy})
+			get := func(key string) {
+				var s string
+				if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < 10; i++ {
+				get(fmt.Sprintf("k%02d", i))
+			}
+			for i := 0; i < 5; i++ {
+				get("k00")
+			}
+			// Scan keys used only once.
+			for i := 10; i < 30; i++ {
+				get(fmt.Sprintf("k%02d", i))
+			}
+			get("k00")
+			if kept := loads["k00"] == 1; kept != tt.keepsHot {
+				t.Errorf("hot key kept = %v; want %v", kept, tt.keepsHot)
+			}
+			stats := g.CacheStats(MainCache)
+			if stats.Items != 10 || stats.Evictions == 0 {
+				t.Errorf("CacheStats = %+v; want 10 items and evictions", stats)
+			}
+			if policy := g.PolicyStats(MainCache); tt.name == "TinyLFU" && policy["rejected"] == 0 {
+				t.Errorf("PolicyStats = %v; want rejected admissions", policy)
+			}
+		})
+	}
+}
+
+func TestCacheSplit(t *testing.T) {
+	const cacheBytes = 100
+	tests := []struct {
+		name      string
+		split     CacheSplit
+		main, hot int64
+		want      CacheType
+	}{
+		{"default fits", defaultSplit{}, 60, 40, 0},
+		{"default hot", defaultSplit{}, 80, 21, HotCache},
+		{"default main", defaultSplit{}, 90, 11, MainCache},
+		{"ratio fits", SplitRatio(0.5), 60, 40, 0},
+		{"ratio hot under total", SplitRatio(0.5), 10, 51, HotCache},
+		{"ratio main", SplitRatio(0.5), 52, 49, MainCache},
+		{"ratio none", SplitRatio(0), 0, 1, HotCache},
+		{"bytes fits", SplitBytes(70, 30), 70, 30, 0},
+		{"bytes hot", SplitBytes(70, 30), 10, 31, HotCache},
+		{"bytes main", SplitBytes(70, 30), 71, 10, MainCache},
+		{"bytes total", SplitBytes(90, 90), 60, 41, MainCache},
+	}
+	for _, tt := range tests {
+		got := tt.split.Victim(cacheBytes, CacheStats{Bytes: tt.main}, CacheStats{Bytes: tt.hot})
+		if got != tt.want {
+			t.Errorf("%s: Victim(main %d, hot %d) = %v; want %v", tt.name, tt.main, tt.hot, got, tt.want)
+		}
+	}
+}
+
+func TestAdaptiveSplit(t *testing.T) {
+	const cacheBytes = 1000
+	split := AdaptiveSplit()
+	var main, hot CacheStats
+	main.Bytes, hot.Bytes = 800, 100
+	share := func() float64 { return split.(*adaptiveSplit).hot }
+
+	// The hotCache serves more hits per byte: its share grows.
+	before := share()
+	for i := 0; i < 5; i++ {
+		main.Gets += adaptiveInterval
+		main.Hits += 100
+		hot.Hits += 100
+		split.Victim(cacheBytes, main, hot)
+	}
+	if share() <= before {
+		t.Fatalf("hotCache share = %v after hot hits; want more than %v", share(), before)
+	}
+
+	// The mainCache serves more hits per byte: its share grows
+	// back, down to the minimum share of the hotCache.
+	for i := 0; i < 50; i++ {
+		main.Gets += adaptiveInterval
+		main.Hits += 1000
+		split.Victim(cacheBytes, main, hot)
+	}
+	if got := share(); got < adaptiveStep || got >= 2*adaptiveStep {
+		t.Fatalf("hotCache share = %v after main hits; want within a step of %v", got, adaptiveStep)
+	}
+	if got := split.Victim(cacheBytes, main, hot); got != HotCache {
+		t.Errorf("Victim with hotCache over its share = %v; want HotCache", got)
+	}
+}
+
+func TestSplitRatioNoHotCache(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGroupOpts("TestSplitRatioNoHotCache-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(key)
+	}), &GroupOptions{CacheSplit: SplitRatio(0)})
+	g.populateCache(dummyCtx, "a", ByteView{s: "value"}, &g.hotCache)
+	if n := g.CacheStats(HotCache).Items; n != 0 {
+		t.Errorf("hotCache holds %d items; want none", n)
+	}
+	g.populateCache(dummyCtx, "b", ByteView{s: "value"}, &g.mainCache)
+	if n := g.CacheStats(MainCache).Items; n != 1 {
+		t.Errorf("mainCache holds %d items; want 1", n)
+	}
+}
+
+func TestServerLoadLocally(t *testing.T) {
+	peer := &fakePeer{}
+	r := NewRegistry()
+	r.newGroup("TestServerLoadLocally-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local:" + key)
+	}), fakePeers([]ProtoGetter{peer}), nil)
+	req := &pb.GetRequest{Group: proto.String("TestServerLoadLocally-group"), Key: proto.String("k")}
+
+	res := &pb.GetResponse{}
+	if err := (&Server{Registry: r}).Get(dummyCtx, req, res); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(res.Value); got != "got:k" || peer.hits != 1 {
+		t.Errorf("Get = %q with %d peer hits; want the peer's value", got, peer.hits)
+	}
+
+	req.Key = proto.String("k2")
+	res = &pb.GetResponse{}
+	if err := (&Server{Registry: r, LoadLocally: true}).Get(dummyCtx, req, res); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(res.Value); got != "local:k2" || peer.hits != 1 {
+		t.Errorf("Get with LoadLocally = %q with %d peer hits; want a local load", got, peer.hits)
+	}
+}
+
+// failoverPicker picks its peers, in order, for every key.
+type failoverPicker []ProtoGetter
+
+func (p failoverPicker) PickPeer(key string) (ProtoGetter, bool)    { return p[0], true }
+func (p failoverPicker) PickPeers(key string) ([]ProtoGetter, bool) { return p, false }
+
+func TestFailover(t *testing.T) {
+	down, up := &fakePeer{fail: true}, &fakePeer{}
+	localLoads := 0
+	g := newGroup("TestFailover-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		localLoads++
+		return dest.SetString("local:" + key)
+	}), failoverPicker{down, up}, nil)
+
+	var s string
+	if err := g.Get(dummyCtx, "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if s != "got:k" || down.hits != 1 || up.hits != 1 || localLoads != 0 {
+		t.Errorf("Get = %q with %d, %d peer hits and %d local loads; want the second peer's value", s, down.hits, up.hits, localLoads)
+	}
+	if n := g.Stats.PeerErrors.Get(); n != 1 {
+		t.Errorf("PeerErrors = %d; want 1", n)
+	}
+
+	// A failed batch goes to the next peer too.
+	values := map[string]*string{"a": new(string), "b": new(string)}
+	if err := g.GetMulti(dummyCtx, []string{"a", "b"}, func(key string) Sink { return StringSink(values[key]) }); err != nil {
+		t.Fatal(err)
+	}
+	if *values["a"] != "got:a" || *values["b"] != "got:b" || down.batches != 1 || localLoads != 0 {
+		t.Errorf("GetMulti = %q, %q with %d failed batches and %d local loads; want the second peer's values",
+			*values["a"], *values["b"], down.batches, localLoads)
+	}
+
+	up.fail = true
+	if err := g.Get(dummyCtx, "z", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if s != "local:z" || localLoads != 1 {
+		t.Errorf("Get with every peer down = %q; want a local load", s)
+	}
+}
+
+// slowPeer is a peer that does not answer until its context is done.
+type slowPeer struct {
+	cancelled chan struct{}
+}
+
+func (p *slowPeer) Get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	<-ctx.Done()
+	close(p.cancelled)
+	return ctx.Err()
+}
+
+// loadCountingPicker is a failoverPicker that counts the loads of the
+// current process.
+type loadCountingPicker struct {
+	failoverPicker
+	loads int32
+}
+
+func (p *loadCountingPicker) BeginLoad() (done func()) {
+	atomic.AddInt32(&p.loads, 1)
+	return func() { atomic.AddInt32(&p.loads, -1) }
+}
+
+func TestHedgedLoad(t *testing.T) {
+	slow, fast := &slowPeer{cancelled: make(chan struct{})}, &fakePeer{}
+	obs := new(testObserver)
+	opts := &GroupOptions{HedgeDelay: time.Millisecond, Observer: obs}
+	g := newGroup("TestHedgedLoad-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local:" + key)
+	}), failoverPicker{slow, fast}, opts)
+
+	var s string
+	if err := g.Get(dummyCtx, "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if s != "got:k" || fast.hits != 1 {
+		t.Errorf("Get = %q with %d hits on the second owner; want its value", s, fast.hits)
+	}
+	select {
+	case <-slow.cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the slow owner's request was not cancelled")
+	}
+	if h, w := g.Stats.Hedges.Get(), g.Stats.HedgesWon.Get(); h != 1 || w != 1 {
+		t.Errorf("Hedges, HedgesWon = %d, %d; want 1, 1", h, w)
+	}
+	if n := g.Stats.PeerErrors.Get(); n != 0 {
+		t.Errorf("PeerErrors = %d; want 0", n)
+	}
+	// The cancelled request of the slow owner isn't a peer error.
+	for i := 0; g.PeerStats()[peerName(slow)] == nil || g.PeerStats()[peerName(slow)].Requests.Get() == 0; i++ {
+		if i == 1000 {
+			t.Fatal("the slow owner's request was never recorded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := g.PeerStats()[peerName(slow)].Errors.Get(); n != 0 || len(g.RecentPeerErrors()) != 0 || len(obs.peerErrors) != 0 {
+		t.Errorf("the lost hedge was recorded as a peer error: %d errors, %v, %v", n, g.RecentPeerErrors(), obs.peerErrors)
+	}
+
+	// With a single owner, the hedge is a local load, counted by
+	// the picker.
+	slow = &slowPeer{cancelled: make(chan struct{})}
+	picker := &loadCountingPicker{failoverPicker: failoverPicker{slow}}
+	var loads int32
+	g = newGroup("TestHedgedLoad-local", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		loads = atomic.LoadInt32(&picker.loads)
+		return dest.SetString("local:" + key)
+	}), picker, opts)
+	if err := g.Get(dummyCtx, "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if loads != 1 || atomic.LoadInt32(&picker.loads) != 0 {
+		t.Errorf("loads counted during the hedge = %d, after = %d; want 1, 0", loads, atomic.LoadInt32(&picker.loads))
+	}
+	if s != "local:k" || g.Stats.LocalLoads.Get() != 1 || g.Stats.HedgesWon.Get() != 1 {
+		t.Errorf("Get = %q with %d local loads; want a local load", s, g.Stats.LocalLoads.Get())
+	}
+	if n := g.CacheStats(MainCache).Items; n != 1 {
+		t.Errorf("mainCache holds %d items; want the hedged value", n)
+	}
+
+	// A fast owner is not hedged.
+	g = newGroup("TestHedgedLoad-fast", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("local:" + key)
+	}), failoverPicker{fast}, &GroupOptions{HedgeDelay: time.Hour})
+	if err := g.Get(dummyCtx, "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if s != "got:k" || g.Stats.Hedges.Get() != 0 {
+		t.Errorf("Get = %q with %d hedges; want the owner's value and no hedge", s, g.Stats.Hedges.Get())
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	for i := 0; i < 2; i++ { // a load, then a cache hit
+		var buf bytes.Buffer
+		if err := stringGroup.Get(dummyCtx, "writer", WriterSink(&buf)); err != nil {
+			t.Fatal(err)
+		}
+		if want := "ECHO:writer"; buf.String() != want {
+			t.Errorf("Get %d wrote %q; want %q", i, buf.String(), want)
+		}
+	}
+}
+
+// testObserver records the events of a group.
+type testObserver struct {
+	NopObserver
+	loads      []LoadEvent
+	peerErrors []PeerErrorEvent
+	evictions  []EvictEvent
+	promotions []HotPromoteEvent
+}
+
+func (o *testObserver) OnLoad(e LoadEvent)             { o.loads = append(o.loads, e) }
+func (o *testObserver) OnPeerError(e PeerErrorEvent)   { o.peerErrors = append(o.peerErrors, e) }
+func (o *testObserver) OnEvict(e EvictEvent)           { o.evictions = append(o.evictions, e) }
+func (o *testObserver) OnHotPromote(e HotPromoteEvent) { o.promotions = append(o.promotions, e) }
+
+func TestObserver(t *testing.T) {
+	obs := new(testObserver)
+	down, up := &fakePeer{fail: true}, &qpsPeer{qps: 100}
+	g := newGroup("TestObserver-peers", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return errors.New("unexpected local load")
+	}), failoverPicker{down, up}, &GroupOptions{HotKeyQPS: 5, Observer: obs})
+	var s string
+	if err := g.Get(dummyCtx, "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if len(obs.peerErrors) != 1 || obs.peerErrors[0].Key != "k" || obs.peerErrors[0].Peer != peerName(down) {
+		t.Errorf("peer errors = %+v; want one from the first peer for k", obs.peerErrors)
+	}
+	if len(obs.promotions) != 1 || obs.promotions[0].Key != "k" || obs.promotions[0].QPS != 100 {
+		t.Errorf("promotions = %+v; want k at 100 QPS", obs.promotions)
+	}
+	if len(obs.loads) != 1 || obs.loads[0].Source != LoadPeer || obs.loads[0].Err != nil {
+		t.Errorf("loads = %+v; want one from a peer", obs.loads)
+	}
+
+	obs = new(testObserver)
+	g = newGroup("TestObserver-local", 10, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		if key == "missing" {
+			return ErrNotFound
+		}
+		return dest.SetString("value")
+	}), NoPeers{}, &GroupOptions{Observer: obs})
+	for _, key := range []string{"a", "b", "missing"} {
+		g.Get(dummyCtx, key, StringSink(&s))
+	}
+	var sources []string
+	for _, e := range obs.loads {
+		sources = append(sources, e.Source.String())
+	}
+	if len(obs.loads) != 3 || !reflect.DeepEqual(sources, []string{"local", "local", "local"}) || obs.loads[2].Err != ErrNotFound {
+		t.Errorf("loads = %+v; want 3 local loads, the last not found", obs.loads)
+	}
+	want := []EvictEvent{{Group: g.Name(), Key: "a", Bytes: 6, Cache: MainCache}}
+	if !reflect.DeepEqual(obs.evictions, want) {
+		t.Errorf("evictions = %+v; want %+v", obs.evictions, want)
+	}
+}
+
+// testTracer records the spans that end, in order.
+type testTracer struct {
+	mu    sync.Mutex
+	n     byte
+	spans []*testSpan
+}
+
+type testSpan struct {
+	tr     *testTracer
+	name   string
+	sc     SpanContext
+	parent SpanContext
+	attrs  map[string]string
+	err    error
+}
+
+func (tr *testTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	tr.mu.Lock()
+	tr.n++
+	s := &testSpan{tr: tr, name: name, parent: SpanContextFromContext(ctx), attrs: make(map[string]string)}
+	s.sc.TraceID = s.parent.TraceID
+	if !s.parent.IsValid() {
+		s.sc.TraceID[0] = 1
+	}
+	s.sc.SpanID[7] = tr.n
+	tr.mu.Unlock()
+	return ctx, s
+}
+
+func (s *testSpan) SetAttribute(key, value string) { s.attrs[key] = value }
+func (s *testSpan) SpanContext() SpanContext       { return s.sc }
+
+func (s *testSpan) End(err error) {
+	s.err = err
+	s.tr.mu.Lock()
+	s.tr.spans = append(s.tr.spans, s)
+	s.tr.mu.Unlock()
+}
+
+// ended returns the spans that ended since the last call.
+func (tr *testTracer) ended() []*testSpan {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	spans := tr.spans
+	tr.spans = nil
+	return spans
+}
+
+func TestTracer(t *testing.T) {
+	tr := new(testTracer)
+	g := newGroup("TestTracer-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value")
+	}), NoPeers{}, &GroupOptions{Tracer: tr})
+	var s string
+	if err := g.Get(dummyCtx, "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	spans := tr.ended()
+	var names []string
+	byName := make(map[string]*testSpan)
+	for _, span := range spans {
+		names = append(names, span.name)
+		byName[strings.TrimPrefix(span.name, "groupcache.")] = span
+	}
+	want := []string{"groupcache.lookupCache", "groupcache.lookupCache", "groupcache.getLocally",
+		"groupcache.populateCache", "groupcache.loadGroup", "groupcache.Get"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("spans = %q; want %q", names, want)
+	}
+	parents := map[string]string{
+		"lookupCache":   "loadGroup",
+		"getLocally":    "loadGroup",
+		"populateCache": "loadGroup",
+		"loadGroup":     "Get",
+	}
+	for child, parent := range parents {
+		if byName[child].parent != byName[parent].sc {
+			t.Errorf("parent of %s is not %s", child, parent)
+		}
+	}
+	if byName["Get"].parent.IsValid() {
+		t.Errorf("Get has parent %v; want none", byName["Get"].parent)
+	}
+	if k := byName["getLocally"].attrs["groupcache.key"]; k != "k" {
+		t.Errorf("getLocally key = %q; want k", k)
+	}
+
+	if err := g.Get(dummyCtx, "k", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	spans = tr.ended()
+	if len(spans) != 2 || spans[0].attrs["groupcache.hit"] != "true" {
+		t.Errorf("cache hit spans = %d, hit %q; want 2 spans, hit true", len(spans), spans[0].attrs["groupcache.hit"])
+	}
+}
+
+func TestCodec(t *testing.T) {
+	value := strings.Repeat("compressible ", 1000)
+	r := NewRegistry()
+	g := r.newGroup("TestCodec-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(value)
+	}), NoPeers{}, &GroupOptions{Codec: GzipCodec(gzip.DefaultCompression)})
+
+	for i := 0; i < 2; i++ { // a load, then a cache hit
+		var s string
+		if err := g.Get(dummyCtx, "k", StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+		if s != value {
+			t.Fatalf("Get %d = %d bytes; want the %d decoded bytes", i, len(s), len(value))
+		}
+	}
+	if n := g.CacheStats(MainCache).Bytes; n >= int64(len(value)) {
+		t.Errorf("mainCache holds %d bytes; want the value compressed", n)
+	}
+
+	// Peers get the value encoded only if they accept the codec.
+	s := &Server{Registry: r}
+	for _, accept := range [][]string{nil, {"gzip"}} {
+		res := &pb.GetResponse{}
+		req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("k"), AcceptCodec: accept}
+		if err := s.Get(dummyCtx, req, res); err != nil {
+			t.Fatal(err)
+		}
+		got := res.GetValue()
+		if res.GetCodec() != "" {
+			var err error
+			if got, err = GzipCodec(0).Decode(got); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if res.GetCodec() != strings.Join(accept, "") || string(got) != value {
+			t.Errorf("accepting %q, Get returned %d bytes encoded by %q", accept, len(res.GetValue()), res.GetCodec())
+		}
+	}
+}
+
+func TestHotKeys(t *testing.T) {
+	g := newGroup("TestHotKeys-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value")
+	}), NoPeers{}, nil)
+	var s string
+	get := func(key string, n int) {
+		for i := 0; i < n; i++ {
+			if err := g.Get(dummyCtx, key, StringSink(&s)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for i := 0; i < 2*maxTopKeys; i++ {
+		get(fmt.Sprint("cold", i), 2)
+	}
+	get("hot", 10)
+	get("warm", 5)
+	for i := 0; i < 2*maxTopKeys; i++ {
+		get(fmt.Sprint("other", i), 2)
+	}
+	keys := g.HotKeys(2)
+	if len(keys) != 2 || keys[0].Key != "hot" || keys[1].Key != "warm" {
+		t.Errorf("HotKeys = %+v; want hot, then warm", keys)
+	}
+	if len(g.HotKeys(100)) != maxTopKeys {
+		t.Errorf("HotKeys tracks %d keys; want %d", len(g.HotKeys(100)), maxTopKeys)
+	}
+}
+
 func TestTruncatingByteSliceTarget(t *testing.T) {
 	var buf [100]byte
 	s := buf[:]
@@ -390,7 +1473,7 @@ func TestNoDedup(t *testing.T) {
 	const testval = "testval"
 	g := newGroup("testgroup", 1024, GetterFunc(func(_ context.Context, key string, dest Sink) error {
 		return dest.SetString(testval)
-	}), nil)
+	}), nil, nil)
 
 	orderedGroup := &orderedFlightGroup{
 		stage1: make(chan bool),
@@ -445,6 +1528,85 @@ func TestNoDedup(t *testing.T) {
 	}
 }
 
+func TestRegistry(t *testing.T) {
+	const name = "TestRegistry-group"
+	getter := GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(key)
+	})
+	r1, r2 := NewRegistry(), NewRegistry()
+	g1 := r1.NewGroup(name, 1<<20, getter)
+	g2 := r2.NewGroup(name, 1<<20, getter)
+	if r1.GetGroup(name) != g1 || r2.GetGroup(name) != g2 {
+		t.Error("GetGroup returned a group from the wrong registry")
+	}
+	if GetGroup(name) != nil {
+		t.Error("group registered in DefaultRegistry")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("duplicate registration didn't panic")
+		}
+	}()
+	r1.NewGroup(name, 1<<20, getter)
+}
+
+func TestClose(t *testing.T) {
+	const name = "TestClose-group"
+	r := NewRegistry()
+	loading := make(chan bool)
+	unblock := make(chan bool)
+	g := r.NewGroup(name, 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		if key == fromChan {
+			loading <- true
+			<-unblock
+		}
+		return dest.SetString("value:" + key)
+	}))
+	var s string
+	if err := g.Get(dummyCtx, "cached", StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+
+	getc := make(chan error)
+	go func() {
+		var s string
+		getc <- g.Get(dummyCtx, fromChan, StringSink(&s))
+	}()
+	<-loading
+
+	closec := make(chan error)
+	go func() { closec <- g.Close() }()
+	select {
+	case <-closec:
+		t.Fatal("Close returned while a load was in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(unblock)
+	if err := <-getc; err != nil {
+		t.Errorf("in-flight Get error = %v; want nil", err)
+	}
+	if err := <-closec; err != nil {
+		t.Errorf("Close error = %v; want nil", err)
+	}
+
+	if err := g.Get(dummyCtx, "cached", StringSink(&s)); err != ErrClosed {
+		t.Errorf("Get after Close error = %v; want ErrClosed", err)
+	}
+	if err := g.Close(); err != ErrClosed {
+		t.Errorf("second Close error = %v; want ErrClosed", err)
+	}
+	if b := g.mainCache.bytes(); b != 0 {
+		t.Errorf("mainCache holds %d bytes after Close; want 0", b)
+	}
+	if r.GetGroup(name) != nil {
+		t.Error("closed group is still registered")
+	}
+	if g2 := r.NewGroup(name, 1<<20, g.getter); r.GetGroup(name) != g2 {
+		t.Error("couldn't register a new group with the name of a closed group")
+	}
+}
+
 func TestGroupStatsAlignment(t *testing.T) {
 	var g Group
 	off := unsafe.Offsetof(g.Stats)
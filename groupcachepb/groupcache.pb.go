@@ -14,9 +14,11 @@ var _ = &json.SyntaxError{}
 var _ = math.Inf
 
 type GetRequest struct {
-	Group            *string `protobuf:"bytes,1,req,name=group" json:"group,omitempty"`
-	Key              *string `protobuf:"bytes,2,req,name=key" json:"key,omitempty"`
-	XXX_unrecognized []byte  `json:"-"`
+	Group            *string  `protobuf:"bytes,1,req,name=group" json:"group,omitempty"`
+	Key              *string  `protobuf:"bytes,2,req,name=key" json:"key,omitempty"`
+	AcceptCodec      []string `protobuf:"bytes,3,rep,name=accept_codec" json:"accept_codec,omitempty"`
+	Failover         *bool    `protobuf:"varint,4,opt,name=failover" json:"failover,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
 }
 
 func (m *GetRequest) Reset()         { *m = GetRequest{} }
@@ -37,9 +39,27 @@ func (m *GetRequest) GetKey() string {
 	return ""
 }
 
+func (m *GetRequest) GetAcceptCodec() []string {
+	if m != nil {
+		return m.AcceptCodec
+	}
+	return nil
+}
+
+func (m *GetRequest) GetFailover() bool {
+	if m != nil && m.Failover != nil {
+		return *m.Failover
+	}
+	return false
+}
+
 type GetResponse struct {
 	Value            []byte   `protobuf:"bytes,1,opt,name=value" json:"value,omitempty"`
 	MinuteQps        *float64 `protobuf:"fixed64,2,opt,name=minute_qps" json:"minute_qps,omitempty"`
+	Expire           *int64   `protobuf:"varint,3,opt,name=expire" json:"expire,omitempty"`
+	Error            *string  `protobuf:"bytes,4,opt,name=error" json:"error,omitempty"`
+	NotFound         *bool    `protobuf:"varint,5,opt,name=not_found" json:"not_found,omitempty"`
+	Codec            *string  `protobuf:"bytes,6,opt,name=codec" json:"codec,omitempty"`
 	XXX_unrecognized []byte   `json:"-"`
 }
 
@@ -61,5 +81,169 @@ func (m *GetResponse) GetMinuteQps() float64 {
 	return 0
 }
 
+func (m *GetResponse) GetExpire() int64 {
+	if m != nil && m.Expire != nil {
+		return *m.Expire
+	}
+	return 0
+}
+
+func (m *GetResponse) GetError() string {
+	if m != nil && m.Error != nil {
+		return *m.Error
+	}
+	return ""
+}
+
+func (m *GetResponse) GetNotFound() bool {
+	if m != nil && m.NotFound != nil {
+		return *m.NotFound
+	}
+	return false
+}
+
+func (m *GetResponse) GetCodec() string {
+	if m != nil && m.Codec != nil {
+		return *m.Codec
+	}
+	return ""
+}
+
+type RemoveRequest struct {
+	Group            *string `protobuf:"bytes,1,req,name=group" json:"group,omitempty"`
+	Key              *string `protobuf:"bytes,2,req,name=key" json:"key,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *RemoveRequest) Reset()         { *m = RemoveRequest{} }
+func (m *RemoveRequest) String() string { return proto.CompactTextString(m) }
+func (*RemoveRequest) ProtoMessage()    {}
+
+func (m *RemoveRequest) GetGroup() string {
+	if m != nil && m.Group != nil {
+		return *m.Group
+	}
+	return ""
+}
+
+func (m *RemoveRequest) GetKey() string {
+	if m != nil && m.Key != nil {
+		return *m.Key
+	}
+	return ""
+}
+
+type RemoveResponse struct {
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *RemoveResponse) Reset()         { *m = RemoveResponse{} }
+func (m *RemoveResponse) String() string { return proto.CompactTextString(m) }
+func (*RemoveResponse) ProtoMessage()    {}
+
+type SetRequest struct {
+	Group            *string `protobuf:"bytes,1,req,name=group" json:"group,omitempty"`
+	Key              *string `protobuf:"bytes,2,req,name=key" json:"key,omitempty"`
+	Value            []byte  `protobuf:"bytes,3,opt,name=value" json:"value,omitempty"`
+	Expire           *int64  `protobuf:"varint,4,opt,name=expire" json:"expire,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *SetRequest) Reset()         { *m = SetRequest{} }
+func (m *SetRequest) String() string { return proto.CompactTextString(m) }
+func (*SetRequest) ProtoMessage()    {}
+
+func (m *SetRequest) GetGroup() string {
+	if m != nil && m.Group != nil {
+		return *m.Group
+	}
+	return ""
+}
+
+func (m *SetRequest) GetKey() string {
+	if m != nil && m.Key != nil {
+		return *m.Key
+	}
+	return ""
+}
+
+func (m *SetRequest) GetValue() []byte {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+func (m *SetRequest) GetExpire() int64 {
+	if m != nil && m.Expire != nil {
+		return *m.Expire
+	}
+	return 0
+}
+
+type SetResponse struct {
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *SetResponse) Reset()         { *m = SetResponse{} }
+func (m *SetResponse) String() string { return proto.CompactTextString(m) }
+func (*SetResponse) ProtoMessage()    {}
+
+type GetMultiRequest struct {
+	Group            *string  `protobuf:"bytes,1,req,name=group" json:"group,omitempty"`
+	Key              []string `protobuf:"bytes,2,rep,name=key" json:"key,omitempty"`
+	AcceptCodec      []string `protobuf:"bytes,3,rep,name=accept_codec" json:"accept_codec,omitempty"`
+	Failover         *bool    `protobuf:"varint,4,opt,name=failover" json:"failover,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *GetMultiRequest) Reset()         { *m = GetMultiRequest{} }
+func (m *GetMultiRequest) String() string { return proto.CompactTextString(m) }
+func (*GetMultiRequest) ProtoMessage()    {}
+
+func (m *GetMultiRequest) GetGroup() string {
+	if m != nil && m.Group != nil {
+		return *m.Group
+	}
+	return ""
+}
+
+func (m *GetMultiRequest) GetKey() []string {
+	if m != nil {
+		return m.Key
+	}
+	return nil
+}
+
+func (m *GetMultiRequest) GetAcceptCodec() []string {
+	if m != nil {
+		return m.AcceptCodec
+	}
+	return nil
+}
+
+func (m *GetMultiRequest) GetFailover() bool {
+	if m != nil && m.Failover != nil {
+		return *m.Failover
+	}
+	return false
+}
+
+type GetMultiResponse struct {
+	Response         []*GetResponse `protobuf:"bytes,1,rep,name=response" json:"response,omitempty"`
+	XXX_unrecognized []byte         `json:"-"`
+}
+
+func (m *GetMultiResponse) Reset()         { *m = GetMultiResponse{} }
+func (m *GetMultiResponse) String() string { return proto.CompactTextString(m) }
+func (*GetMultiResponse) ProtoMessage()    {}
+
+func (m *GetMultiResponse) GetResponse() []*GetResponse {
+	if m != nil {
+		return m.Response
+	}
+	return nil
+}
+
 func init() {
 }
@@ -0,0 +1,158 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// groupcachez.go serves a page describing the groups of a Registry.
+
+package groupcache
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/golang/groupcache/consistenthash"
+)
+
+// debugHotKeys is the number of hottest keys shown for each group.
+const debugHotKeys = 10
+
+// DebugHandler returns an http.Handler serving a page that describes
+// the groups of r: their Stats, cache sizes, peers with their virtual
+// nodes, recent peer errors, hottest keys and loads in progress. It
+// is typically served at /groupcachez. The page is in JSON if the
+// request has the query parameter format=json or only accepts
+// application/json, and in HTML otherwise. If r is nil, it describes
+// the groups of DefaultRegistry. The peers of a group are shown once
+// the group is first used, since looking at it doesn't pick them.
+func DebugHandler(r *Registry) http.Handler {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		groups := r.Groups()
+		page := make([]groupDebug, len(groups))
+		for i, g := range groups {
+			page[i] = g.debug()
+		}
+		if req.URL.Query().Get("format") == "json" || req.Header.Get("Accept") == "application/json" {
+			w.Header().Set("Content-Type", "application/json")
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			enc.Encode(page)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := debugTemplate.Execute(w, page); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// groupDebug describes a group on the debug page.
+type groupDebug struct {
+	Name       string
+	Stats      map[string]int64
+	MainCache  CacheStats
+	HotCache   CacheStats
+	Peers      []consistenthash.Item
+	PeersInit  bool // whether the group has picked its peers yet
+	PeerErrors []PeerError
+	HotKeys    []HotKey
+	InFlight   []string
+}
+
+// ringer is implemented by PeerPickers that can describe their peers,
+// such as HTTPPool.
+type ringer interface {
+	Ring() []consistenthash.Item
+}
+
+func (g *Group) debug() groupDebug {
+	d := groupDebug{
+		Name:       g.name,
+		Stats:      make(map[string]int64),
+		MainCache:  g.CacheStats(MainCache),
+		HotCache:   g.CacheStats(HotCache),
+		PeerErrors: g.RecentPeerErrors(),
+		HotKeys:    g.HotKeys(debugHotKeys),
+		InFlight:   g.InFlight(),
+	}
+	stats := reflect.ValueOf(&g.Stats).Elem()
+	for i := 0; i < stats.NumField(); i++ {
+		d.Stats[stats.Type().Field(i).Name] = stats.Field(i).Addr().Interface().(*AtomicInt).Get()
+	}
+	// Looking at the group doesn't pick its peers: that is left to
+	// its first use.
+	d.PeersInit = atomic.LoadInt32(&g.peersInit) != 0
+	if d.PeersInit {
+		if r, ok := g.peers.(ringer); ok {
+			d.Peers = r.Ring()
+		}
+	}
+	return d
+}
+
+var debugTemplate = template.Must(template.New("groupcachez").Funcs(template.FuncMap{
+	"percent": func(f float64) string { return strconv.FormatFloat(100*f, 'f', 1, 64) + "%" },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><title>groupcachez</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 6px; text-align: left; }
+</style>
+</head>
+<body>
+<h1>groupcachez</h1>
+{{range .}}
+<h2>{{.Name}}</h2>
+<h3>Stats</h3>
+<table>{{range $name, $value := .Stats}}<tr><th>{{$name}}</th><td>{{$value}}</td></tr>{{end}}</table>
+<h3>Caches</h3>
+<table>
+<tr><th></th><th>Bytes</th><th>Items</th><th>Gets</th><th>Hits</th><th>Evictions</th></tr>
+{{with .MainCache}}<tr><th>main</th><td>{{.Bytes}}</td><td>{{.Items}}</td><td>{{.Gets}}</td><td>{{.Hits}}</td><td>{{.Evictions}}</td></tr>{{end}}
+{{with .HotCache}}<tr><th>hot</th><td>{{.Bytes}}</td><td>{{.Items}}</td><td>{{.Gets}}</td><td>{{.Hits}}</td><td>{{.Evictions}}</td></tr>{{end}}
+</table>
+{{if not .PeersInit}}<h3>Peers</h3>
+<p>uninitialized</p>
+{{else}}{{with .Peers}}<h3>Peers</h3>
+<table>
+<tr><th>Peer</th><th>Virtual nodes</th><th>Share of keys</th></tr>
+{{range .}}<tr><td>{{.Name}}</td><td>{{.Nodes}}</td><td>{{percent .Share}}</td></tr>{{end}}
+</table>{{end}}{{end}}
+{{with .PeerErrors}}<h3>Recent peer errors</h3>
+<table>
+<tr><th>Time</th><th>Peer</th><th>Key</th><th>Error</th></tr>
+{{range .}}<tr><td>{{.Time.Format "2006-01-02 15:04:05.000"}}</td><td>{{.Peer}}</td><td>{{.Key}}</td><td>{{.Error}}</td></tr>{{end}}
+</table>{{end}}
+{{with .HotKeys}}<h3>Hot keys</h3>
+<table>
+<tr><th>Key</th><th>QPS</th><th>Cache</th></tr>
+{{range .}}<tr><td>{{.Key}}</td><td>{{printf "%.3f" .QPS}}</td><td>{{.Cache}}</td></tr>{{end}}
+</table>{{end}}
+{{with .InFlight}}<h3>Loads in progress</h3>
+<ul>{{range .}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{else}}
+<p>No groups.</p>
+{{end}}
+</body>
+</html>
+`))
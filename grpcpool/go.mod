@@ -0,0 +1,22 @@
+module github.com/golang/groupcache/grpcpool
+
+go 1.20
+
+require (
+	github.com/golang/groupcache v0.0.0
+	github.com/golang/protobuf v1.5.4
+	google.golang.org/grpc v1.60.1
+)
+
+require (
+	golang.org/x/net v0.16.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20231002182017-d307bd883b97 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+)
+
+// No published version of groupcache has Server and Registry yet; see
+// the package doc. Require one, and keep this replace for local
+// development only, once it is published.
+replace github.com/golang/groupcache => ../
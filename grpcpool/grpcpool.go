@@ -0,0 +1,325 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package grpcpool provides a gRPC transport between groupcache peers.
+//
+// The server side serves the GroupCache service declared in
+// groupcachepb; the client side is a groupcache.PeerPicker that picks
+// the owner of a key by consistent hashing and keeps one connection to
+// each peer.
+//
+// grpcpool is a module of its own, so that only its users depend on
+// gRPC. No published version of groupcache has the Server and Registry
+// that it needs yet, so its go.mod requires groupcache from the parent
+// directory through a replace directive, which Go ignores in
+// dependencies: until such a version is published and required,
+// grpcpool builds only within a checkout of groupcache, and go get
+// cannot fetch it.
+package grpcpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/golang/groupcache"
+	"github.com/golang/groupcache/consistenthash"
+	pb "github.com/golang/groupcache/groupcachepb"
+)
+
+const serviceName = "groupcachepb.GroupCache"
+
+const defaultReplicas = 50
+
+// RegisterServer registers the GroupCache service on s, serving the
+// groups of r. If r is nil, it serves the groups of
+// groupcache.DefaultRegistry.
+func RegisterServer(s grpc.ServiceRegistrar, r *groupcache.Registry) {
+	s.RegisterService(&serviceDesc, &groupcache.Server{Registry: r})
+}
+
+// service is the interface of the GroupCache service.
+type service interface {
+	Get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error
+	Remove(ctx context.Context, in *pb.RemoveRequest, out *pb.RemoveResponse) error
+	Set(ctx context.Context, in *pb.SetRequest, out *pb.SetResponse) error
+	GetMulti(ctx context.Context, in *pb.GetMultiRequest, out *pb.GetMultiResponse) error
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*service)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Get", Handler: getHandler},
+		{MethodName: "Remove", Handler: removeHandler},
+		{MethodName: "Set", Handler: setHandler},
+		{MethodName: "GetMulti", Handler: getMultiHandler},
+	},
+	Metadata: "groupcache.proto",
+}
+
+func getHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(pb.GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	return intercept(ctx, srv, "Get", in, interceptor, func(ctx context.Context, req interface{}) (interface{}, error) {
+		out := new(pb.GetResponse)
+		return out, toStatus(srv.(service).Get(ctx, req.(*pb.GetRequest), out))
+	})
+}
+
+func removeHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(pb.RemoveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	return intercept(ctx, srv, "Remove", in, interceptor, func(ctx context.Context, req interface{}) (interface{}, error) {
+		out := new(pb.RemoveResponse)
+		return out, toStatus(srv.(service).Remove(ctx, req.(*pb.RemoveRequest), out))
+	})
+}
+
+func setHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(pb.SetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	return intercept(ctx, srv, "Set", in, interceptor, func(ctx context.Context, req interface{}) (interface{}, error) {
+		out := new(pb.SetResponse)
+		return out, toStatus(srv.(service).Set(ctx, req.(*pb.SetRequest), out))
+	})
+}
+
+func getMultiHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(pb.GetMultiRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	return intercept(ctx, srv, "GetMulti", in, interceptor, func(ctx context.Context, req interface{}) (interface{}, error) {
+		out := new(pb.GetMultiResponse)
+		return out, toStatus(srv.(service).GetMulti(ctx, req.(*pb.GetMultiRequest), out))
+	})
+}
+
+// intercept calls handler with in, through interceptor if it is not nil.
+func intercept(ctx context.Context, srv interface{}, method string, in interface{}, interceptor grpc.UnaryServerInterceptor, handler grpc.UnaryHandler) (interface{}, error) {
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + serviceName + "/" + method,
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// toStatus converts the errors of a groupcache.Server to gRPC status
+// errors.
+func toStatus(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, groupcache.ErrNoGroup):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+// Pool implements groupcache.PeerPicker for a pool of gRPC peers.
+type Pool struct {
+	// this peer's address, e.g. "10.0.0.1:8080"
+	self string
+
+	// opts specifies the options.
+	opts Options
+
+	mu      sync.Mutex // guards peers and clients
+	peers   *consistenthash.Map
+	clients map[string]*client // keyed by address
+}
+
+// Options are the configurations of a Pool.
+type Options struct {
+	// Replicas specifies the number of key replicas on the consistent hash.
+	// If blank, it defaults to 50.
+	Replicas int
+
+	// HashFn specifies the hash function of the consistent hash.
+	// If blank, it defaults to crc32.ChecksumIEEE.
+	HashFn consistenthash.Hash
+
+	// Registry specifies the Registry for which the pool registers
+	// itself as the PeerPicker.
+	// If nil, it defaults to groupcache.DefaultRegistry.
+	Registry *groupcache.Registry
+
+	// DialOptions specifies the options of the connections to peers.
+	// If nil, connections are made without transport security.
+	DialOptions []grpc.DialOption
+}
+
+// New initializes a gRPC pool of peers with the given options, and
+// registers itself as a PeerPicker. The self argument is the address
+// at which the other peers reach the current server, for example
+// "10.0.0.1:8080". Serving requests from the other peers is done by a
+// grpc.Server on which RegisterServer was called.
+//
+// At most one pool may be created for each Registry.
+func New(self string, o *Options) *Pool {
+	p := &Pool{
+		self:    self,
+		clients: make(map[string]*client),
+	}
+	if o != nil {
+		p.opts = *o
+	}
+	if p.opts.Replicas == 0 {
+		p.opts.Replicas = defaultReplicas
+	}
+	if p.opts.Registry == nil {
+		p.opts.Registry = groupcache.DefaultRegistry
+	}
+	if p.opts.DialOptions == nil {
+		p.opts.DialOptions = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	p.peers = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+
+	p.opts.Registry.RegisterPeerPicker(func() groupcache.PeerPicker { return p })
+	return p
+}
+
+// Set updates the pool's list of peers. Each peer value is an address
+// that grpc.Dial accepts. Connections to peers that remain in the pool
+// are kept; connections to removed peers are closed.
+func (p *Pool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.peers = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+	p.peers.Add(peers...)
+	clients := make(map[string]*client, len(peers))
+	for _, peer := range peers {
+		if peer == p.self {
+			continue
+		}
+		if c, ok := p.clients[peer]; ok {
+			clients[peer] = c
+			continue
+		}
+		conn, err := grpc.Dial(peer, p.opts.DialOptions...)
+		clients[peer] = &client{addr: peer, conn: conn, err: err}
+	}
+	for peer, c := range p.clients {
+		if _, ok := clients[peer]; !ok {
+			c.close()
+		}
+	}
+	p.clients = clients
+}
+
+func (p *Pool) PickPeer(key string) (groupcache.ProtoGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers.IsEmpty() {
+		return nil, false
+	}
+	if peer := p.peers.Get(key); peer != p.self {
+		return p.clients[peer], true
+	}
+	return nil, false
+}
+
+// Ring returns the pool's peers, including this process, with their
+// virtual nodes and shares of the keys.
+func (p *Pool) Ring() []consistenthash.Item {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.peers.Items()
+}
+
+// ListPeers returns the pool's peers, excluding this process.
+func (p *Pool) ListPeers() []groupcache.ProtoGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	peers := make([]groupcache.ProtoGetter, 0, len(p.clients))
+	for _, c := range p.clients {
+		peers = append(peers, c)
+	}
+	return peers
+}
+
+// Close closes the connections to all peers and empties the pool.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var err error
+	for _, c := range p.clients {
+		if cerr := c.close(); err == nil {
+			err = cerr
+		}
+	}
+	p.peers = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+	p.clients = make(map[string]*client)
+	return err
+}
+
+// client calls the GroupCache service of a peer. Calls honor the
+// deadline and cancellation of their context.
+type client struct {
+	addr string
+	conn *grpc.ClientConn
+	err  error // of grpc.Dial
+}
+
+// String returns the address of the peer.
+func (c *client) String() string { return c.addr }
+
+func (c *client) Get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	return c.invoke(ctx, "Get", in, out)
+}
+
+func (c *client) Remove(ctx context.Context, in *pb.RemoveRequest, out *pb.RemoveResponse) error {
+	return c.invoke(ctx, "Remove", in, out)
+}
+
+func (c *client) Set(ctx context.Context, in *pb.SetRequest, out *pb.SetResponse) error {
+	return c.invoke(ctx, "Set", in, out)
+}
+
+func (c *client) GetMulti(ctx context.Context, in *pb.GetMultiRequest, out *pb.GetMultiResponse) error {
+	return c.invoke(ctx, "GetMulti", in, out)
+}
+
+func (c *client) invoke(ctx context.Context, method string, in, out interface{}) error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.conn.Invoke(ctx, "/"+serviceName+"/"+method, in, out)
+}
+
+func (c *client) close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package grpcpool
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/golang/groupcache"
+	pb "github.com/golang/groupcache/groupcachepb"
+)
+
+const testGroup = "grpcpool-test"
+
+// newTestPeers starts a server for the groups of a new registry, the
+// remote peer, and returns it with a new registry whose Pool sends
+// every key to the remote peer.
+func newTestPeers(t *testing.T, getter groupcache.Getter) (remote, local *groupcache.Registry, pool *Pool) {
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	remote = groupcache.NewRegistry()
+	remote.NewGroup(testGroup, 1<<20, getter)
+	RegisterServer(s, remote)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	local = groupcache.NewRegistry()
+	pool = New("local", &Options{
+		Registry: local,
+		DialOptions: []grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return lis.DialContext(ctx)
+			}),
+		},
+	})
+	pool.Set("remote")
+	t.Cleanup(func() { pool.Close() })
+	return remote, local, pool
+}
+
+func TestGet(t *testing.T) {
+	deadlines := make(chan bool, 1)
+	remote, local, _ := newTestPeers(t, groupcache.GetterFunc(func(ctx context.Context, key string, dest groupcache.Sink) error {
+		_, ok := ctx.Deadline()
+		deadlines <- ok
+		if key == "missing" {
+			return groupcache.ErrNotFound
+		}
+		return dest.SetString("remote:" + key)
+	}))
+	g := local.NewGroup(testGroup, 1<<20, groupcache.GetterFunc(func(_ context.Context, key string, dest groupcache.Sink) error {
+		return dest.SetString("local:" + key)
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	var s string
+	if err := g.Get(ctx, "foo", groupcache.StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if s != "remote:foo" {
+		t.Errorf("Get = %q; want %q", s, "remote:foo")
+	}
+	if !<-deadlines {
+		t.Error("remote load had no deadline")
+	}
+	if n := remote.GetGroup(testGroup).Stats.ServerRequests.Get(); n != 1 {
+		t.Errorf("remote ServerRequests = %d; want 1", n)
+	}
+
+	err := g.Get(ctx, "missing", groupcache.StringSink(&s))
+	<-deadlines
+	if !errors.Is(err, groupcache.ErrNotFound) {
+		t.Errorf("Get of a missing key = %v; want ErrNotFound", err)
+	}
+}
+
+func TestNoGroup(t *testing.T) {
+	_, _, pool := newTestPeers(t, groupcache.GetterFunc(func(_ context.Context, key string, dest groupcache.Sink) error {
+		return dest.SetString(key)
+	}))
+	peer, ok := pool.PickPeer("foo")
+	if !ok {
+		t.Fatal("PickPeer found no peer")
+	}
+	req := &pb.GetRequest{Group: proto.String("no-such-group"), Key: proto.String("foo")}
+	err := peer.Get(context.Background(), req, &pb.GetResponse{})
+	if status.Code(err) != codes.NotFound || !strings.Contains(err.Error(), "no such group") {
+		t.Errorf("Get from an unknown group = %v; want NotFound", err)
+	}
+}
+
+func TestRemoveSetGetMulti(t *testing.T) {
+	remote, _, pool := newTestPeers(t, groupcache.GetterFunc(func(_ context.Context, key string, dest groupcache.Sink) error {
+		return dest.SetString("loaded:" + key)
+	}))
+	peer, _ := pool.PickPeer("foo")
+	ctx := context.Background()
+
+	set := &pb.SetRequest{Group: proto.String(testGroup), Key: proto.String("foo"), Value: []byte("set")}
+	if err := peer.(groupcache.ProtoSetter).Set(ctx, set, &pb.SetResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	multi := &pb.GetMultiRequest{Group: proto.String(testGroup), Key: []string{"foo", "bar"}}
+	res := &pb.GetMultiResponse{}
+	if err := peer.(groupcache.ProtoMultiGetter).GetMulti(ctx, multi, res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Response) != 2 || string(res.Response[0].Value) != "set" || string(res.Response[1].Value) != "loaded:bar" {
+		t.Errorf("GetMulti = %v; want values set and loaded:bar", res.Response)
+	}
+
+	remove := &pb.RemoveRequest{Group: proto.String(testGroup), Key: proto.String("foo")}
+	if err := peer.(groupcache.ProtoRemover).Remove(ctx, remove, &pb.RemoveResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	var s string
+	if err := remote.GetGroup(testGroup).Get(ctx, "foo", groupcache.StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if s != "loaded:foo" {
+		t.Errorf("Get after Remove = %q; want %q", s, "loaded:foo")
+	}
+}
+
+func TestSetKeepsConnections(t *testing.T) {
+	_, _, pool := newTestPeers(t, groupcache.GetterFunc(func(_ context.Context, key string, dest groupcache.Sink) error {
+		return dest.SetString(key)
+	}))
+	c := pool.clients["remote"]
+	pool.Set("local", "remote")
+	if pool.clients["remote"] != c {
+		t.Error("Set replaced the connection to a remaining peer")
+	}
+	if _, ok := pool.clients["local"]; ok {
+		t.Error("Set connected to the pool's own address")
+	}
+	if n := len(pool.ListPeers()); n != 1 {
+		t.Errorf("ListPeers returned %d peers; want 1", n)
+	}
+	pool.Set("local")
+	if _, ok := pool.clients["remote"]; ok {
+		t.Error("Set kept a removed peer")
+	}
+	if err := c.Get(context.Background(), &pb.GetRequest{Group: proto.String(testGroup), Key: proto.String("foo")}, &pb.GetResponse{}); status.Code(err) != codes.Canceled {
+		t.Errorf("Get on the connection of a removed peer = %v; want Canceled", err)
+	}
+	if _, ok := pool.PickPeer("foo"); ok {
+		t.Error("PickPeer picked a remote peer from a pool of only itself")
+	}
+}
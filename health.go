@@ -0,0 +1,210 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// health.go tracks the health of the peers of an HTTPPool.
+
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// healthPath is the path, under the BasePath of an HTTPPool, of the
+// endpoint that reports that the pool serves requests.
+const healthPath = "_health"
+
+const defaultBreakerTimeout = 10 * time.Second
+
+// errCircuitOpen is returned for requests to a peer whose circuit is
+// open.
+var errCircuitOpen = errors.New("groupcache: peer circuit open")
+
+// A breaker is the circuit breaker of a peer. The circuit opens after
+// a number of consecutive failed requests to the peer, then no
+// requests are sent to the peer for a timeout. After the timeout, the
+// circuit is half-open: a single request probes the peer, closing the
+// circuit if it succeeds and opening it again if it fails.
+type breaker struct {
+	failures int           // that open the circuit; zero means never
+	timeout  time.Duration // of an open circuit
+
+	mu        sync.Mutex
+	failed    int       // consecutive failures
+	openUntil time.Time // zero if closed
+	probing   bool      // a half-open probe is in progress
+}
+
+// available reports whether the peer may be picked: its circuit is
+// closed, or half-open without a probe in progress.
+func (b *breaker) available(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.openUntil.IsZero() || !now.Before(b.openUntil) && !b.probing
+}
+
+// allow reports whether a request may be sent to the peer. A request
+// allowed by a half-open circuit is its probe.
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if now.Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// success records a successful request, which closes the circuit.
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failed = 0
+	b.openUntil = time.Time{}
+	b.probing = false
+}
+
+// failure records a failed request, which opens the circuit if it is
+// half-open or if enough requests failed in a row.
+func (b *breaker) failure(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failed++
+	if b.probing || b.failures > 0 && b.failed >= b.failures {
+		b.openLocked(now)
+	}
+}
+
+// cancel records a request given up by its caller, which says nothing
+// of the peer. If it was the probe of a half-open circuit, the circuit
+// opens again, so that another request probes it after the timeout.
+func (b *breaker) cancel(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.probing {
+		b.openLocked(now)
+	}
+}
+
+// trip opens the circuit.
+func (b *breaker) trip(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.openLocked(now)
+}
+
+func (b *breaker) openLocked(now time.Time) {
+	timeout := b.timeout
+	if timeout == 0 {
+		timeout = defaultBreakerTimeout
+	}
+	b.openUntil = now.Add(timeout)
+	b.probing = false
+}
+
+// record reports the outcome of a request to the peer, which failed if
+// err is not nil, to its breaker. The caller giving up says nothing of
+// the peer.
+func (h *httpGetter) record(ctx context.Context, err error) {
+	switch {
+	case h.breaker == nil:
+	case err == nil:
+		h.breaker.success()
+	case ctx.Err() != nil:
+		h.breaker.cancel(timeNow())
+	default:
+		h.breaker.failure(timeNow())
+	}
+}
+
+// unavailable reports whether an HTTP status code means that the peer,
+// or a proxy in front of it, can't serve requests.
+func unavailable(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+// checkHealth requests the health endpoint of the peer.
+func (h *httpGetter) checkHealth(ctx context.Context) error {
+	req, err := http.NewRequest(http.MethodGet, h.baseURL+healthPath, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	tr := http.DefaultTransport
+	if h.transport != nil {
+		tr = h.transport(ctx)
+	}
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	return nil
+}
+
+// checkHealth checks the health endpoints of the pool's peers every
+// interval, until the pool is closed. A failed check opens the circuit
+// of the peer, and a successful one closes it.
+func (p *HTTPPool) checkHealth(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.closed:
+			return
+		case <-t.C:
+		}
+		var wg sync.WaitGroup
+		for _, h := range p.remotes() {
+			wg.Add(1)
+			go func(h *httpGetter) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				defer cancel()
+				if err := h.checkHealth(ctx); err != nil {
+					h.breaker.trip(timeNow())
+				} else {
+					h.breaker.success()
+				}
+			}(h)
+		}
+		wg.Wait()
+	}
+}
+
+// remotes returns the getters of the pool's peers, excluding this
+// process.
+func (p *HTTPPool) remotes() []*httpGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	getters := make([]*httpGetter, 0, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if peer != p.self {
+			getters = append(getters, getter)
+		}
+	}
+	return getters
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// hedge.go races slow peers against a second request for the same key.
+
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// hedgeResult is the outcome of one of the requests of getHedged.
+type hedgeResult struct {
+	value ByteView
+	err   error
+	hedge bool
+}
+
+// getHedged fetches key from peers[0] and, if it has not answered
+// within the group's HedgeDelay, hedges by racing it against a fetch
+// from peers[1], or against a local load if peers has a single peer.
+// It returns the first value or ErrNotFound and cancels the other
+// request. Otherwise it returns the error of a failed request.
+//
+// The peers other than owner are sent failover requests, and a local
+// load is counted in picker, from which peers were picked. tried is the
+// number of peers that were tried, and local reports whether value and
+// err are the result of a local load.
+func (g *Group) getHedged(ctx context.Context, key string, picker PeerPicker, peers []ProtoGetter, owner ProtoGetter) (value ByteView, err error, tried int, local bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // stops the loser
+	results := make(chan hedgeResult, 2)
+	fetch := func(peer ProtoGetter, hedge bool) {
+		value, err := g.getFromPeer(ctx, peer, key, peer != owner)
+		results <- hedgeResult{value, err, hedge}
+	}
+	go fetch(peers[0], false)
+	tried = 1
+	localHedge := len(peers) == 1
+
+	timer := time.NewTimer(g.opts.HedgeDelay)
+	defer timer.Stop()
+	for pending := 1; pending > 0; {
+		select {
+		case <-timer.C:
+			g.Stats.Hedges.Add(1)
+			pending++
+			if !localHedge {
+				tried = 2
+				go fetch(peers[1], true)
+				break
+			}
+			go func() {
+				// Load into a private sink: the caller copies
+				// the value to its own if the hedge wins.
+				var v ByteView
+				done := beginLoad(picker)
+				value, err := g.getLocally(ctx, key, ByteViewSink(&v))
+				done()
+				results <- hedgeResult{value, err, true}
+			}()
+		case r := <-results:
+			pending--
+			isLocal := r.hedge && localHedge
+			if r.err == nil || r.err == ErrNotFound || isLocal && errors.Is(r.err, ErrNotFound) {
+				if r.hedge {
+					g.Stats.HedgesWon.Add(1)
+				}
+				return r.value, r.err, tried, isLocal
+			}
+			if isLocal {
+				// Report the local error in preference to
+				// the peer's, so that load does not retry
+				// locally.
+				err, local = r.err, true
+				continue
+			}
+			g.Stats.PeerErrors.Add(1)
+			if !local {
+				err = r.err
+			}
+		}
+	}
+	return value, err, tried, local
+}
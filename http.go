@@ -19,12 +19,14 @@ package groupcache
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/golang/groupcache/consistenthash"
 	pb "github.com/golang/groupcache/groupcachepb"
@@ -53,8 +55,14 @@ type HTTPPool struct {
 	// opts specifies the options.
 	opts HTTPPoolOptions
 
+	// server answers the requests of peers.
+	server Server
+
+	closed    chan struct{} // closed by Close
+	closeOnce sync.Once
+
 	mu          sync.Mutex // guards peers and httpGetters
-	peers       *consistenthash.Map
+	peers       consistenthash.Picker
 	httpGetters map[string]*httpGetter // keyed by e.g. "http://10.0.0.2:8008"
 }
 
@@ -71,6 +79,75 @@ type HTTPPoolOptions struct {
 	// HashFn specifies the hash function of the consistent hash.
 	// If blank, it defaults to crc32.ChecksumIEEE.
 	HashFn consistenthash.Hash
+
+	// Registry specifies the Registry whose groups the pool serves
+	// and for which it registers itself as the PeerPicker.
+	// If nil, it defaults to DefaultRegistry.
+	Registry *Registry
+
+	// BoundedLoad, if positive, makes the pool pick peers by
+	// consistent hashing with bounded loads: a key goes to the first
+	// peer on the ring whose requests in progress from this process
+	// are fewer than 1+BoundedLoad times the average, rather than to
+	// its owner. The pool then loads the keys it receives from peers
+	// itself. All peers of a pool must agree on this option.
+	BoundedLoad float64
+
+	// NewPicker optionally specifies how the pool maps keys to
+	// peers, such as with consistenthash.NewRendezvous. It is
+	// called for a new, empty Picker each time the peers are set.
+	// If nil, the pool uses a consistenthash.Map with Replicas and
+	// HashFn, or a consistenthash.BoundedMap if BoundedLoad is
+	// positive.
+	NewPicker func() consistenthash.Picker
+
+	// Failover specifies how many peers after the owner of a key,
+	// in the order of a consistenthash.MultiPicker, take over the
+	// key when the peers before them fail. Peers thus keep
+	// deduplicating the loads of the keys of a peer that is down.
+	// If zero, a key is loaded locally when its owner fails.
+	Failover int
+
+	// BreakerFailures, if positive, specifies after how many
+	// consecutive failed requests to a peer its circuit opens. The
+	// pool then doesn't pick the peer, passing its keys on as if it
+	// failed, for BreakerTimeout. After that, a single request probes
+	// the peer, closing the circuit if it succeeds.
+	BreakerFailures int
+
+	// BreakerTimeout specifies how long the circuit of a failing
+	// peer stays open.
+	// If zero, it defaults to 10 seconds.
+	BreakerTimeout time.Duration
+
+	// HealthCheckInterval, if positive, makes the pool request the
+	// health endpoint of each peer, BasePath + "_health", at that
+	// interval. A failed check opens the circuit of the peer, and a
+	// successful one closes it. Close stops the checks.
+	HealthCheckInterval time.Duration
+
+	// StreamThreshold specifies the size in bytes from which values
+	// are streamed to peers as the raw response body, rather than
+	// marshaled into a GetResponse message, so that neither side
+	// holds a second copy of the value. Peers that don't ask for
+	// streamed values get messages.
+	// If zero, it defaults to 1 MiB. If negative, values are never
+	// streamed.
+	StreamThreshold int
+
+	// Secret, if not empty, makes the pool sign its requests to
+	// peers with HMAC-SHA256 under Secret, and reject the requests
+	// that aren't signed with it within the last five minutes. All
+	// peers must share the secret. Health checks are not signed.
+	Secret []byte
+
+	// VerifyClientCert makes the pool reject requests that don't
+	// come over TLS with a client certificate valid for the host of
+	// one of its peers. The certificate must be verified by the
+	// http.Server, whose tls.Config should have ClientAuth set to
+	// tls.RequireAndVerifyClientCert, and the pool's Transport
+	// should present this process's certificate.
+	VerifyClientCert bool
 }
 
 // NewHTTPPool initializes an HTTP pool of peers, and registers itself as a PeerPicker.
@@ -83,20 +160,16 @@ func NewHTTPPool(self string) *HTTPPool {
 	return p
 }
 
-var httpPoolMade bool
-
 // NewHTTPPoolOpts initializes an HTTP pool of peers with the given options.
 // Unlike NewHTTPPool, this function does not register the created pool as an HTTP handler.
 // The returned *HTTPPool implements http.Handler and must be registered using http.Handle.
+//
+// At most one pool may be created for each Registry.
 func NewHTTPPoolOpts(self string, o *HTTPPoolOptions) *HTTPPool {
-	if httpPoolMade {
-		panic("groupcache: NewHTTPPool must be called only once")
-	}
-	httpPoolMade = true
-
 	p := &HTTPPool{
 		self:        self,
 		httpGetters: make(map[string]*httpGetter),
+		closed:      make(chan struct{}),
 	}
 	if o != nil {
 		p.opts = *o
@@ -107,36 +180,224 @@ func NewHTTPPoolOpts(self string, o *HTTPPoolOptions) *HTTPPool {
 	if p.opts.Replicas == 0 {
 		p.opts.Replicas = defaultReplicas
 	}
-	p.peers = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+	if p.opts.Registry == nil {
+		p.opts.Registry = DefaultRegistry
+	}
+	if p.opts.StreamThreshold == 0 {
+		p.opts.StreamThreshold = defaultStreamThreshold
+	}
+	p.peers = p.newPicker()
+	p.server.Registry = p.opts.Registry
+	_, p.server.LoadLocally = p.peers.(*consistenthash.BoundedMap)
 
-	RegisterPeerPicker(func() PeerPicker { return p })
+	p.opts.Registry.RegisterPeerPicker(func() PeerPicker { return p })
+	if p.opts.HealthCheckInterval > 0 {
+		go p.checkHealth(p.opts.HealthCheckInterval)
+	}
 	return p
 }
 
+// Close stops the health checks of the pool.
+func (p *HTTPPool) Close() error {
+	p.closeOnce.Do(func() { close(p.closed) })
+	return nil
+}
+
 // Set updates the pool's list of peers.
 // Each peer value should be a valid base URL,
 // for example "http://example.net:8000".
 func (p *HTTPPool) Set(peers ...string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.peers = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+	p.peers = p.newPicker()
 	p.peers.Add(peers...)
 	p.httpGetters = make(map[string]*httpGetter, len(peers))
 	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{transport: p.Transport, baseURL: peer + p.opts.BasePath}
+		p.httpGetters[peer] = p.newGetter(peer)
+	}
+}
+
+// SetWeighted is like Set, but gives each peer a share of the keys
+// proportional to its weight, for example the size of its cache in
+// gigabytes. Peers with a weight under 1 are left out of the pool.
+func (p *HTTPPool) SetWeighted(peers map[string]int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.peers = p.newPicker()
+	p.peers.AddWeighted(peers)
+	p.httpGetters = make(map[string]*httpGetter, len(peers))
+	for peer, weight := range peers {
+		if weight > 0 {
+			p.httpGetters[peer] = p.newGetter(peer)
+		}
+	}
+}
+
+func (p *HTTPPool) newPicker() consistenthash.Picker {
+	if p.opts.NewPicker != nil {
+		return p.opts.NewPicker()
+	}
+	if p.opts.BoundedLoad > 0 {
+		return consistenthash.NewBounded(p.opts.Replicas, p.opts.HashFn, p.opts.BoundedLoad)
+	}
+	return consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+}
+
+// newGetter returns the getter of peer. p.mu must be held.
+func (p *HTTPPool) newGetter(peer string) *httpGetter {
+	h := &httpGetter{
+		transport: p.Transport,
+		baseURL:   peer + p.opts.BasePath,
+		peer:      peer,
+		secret:    p.opts.Secret,
+		breaker: &breaker{
+			failures: p.opts.BreakerFailures,
+			timeout:  p.opts.BreakerTimeout,
+		},
+	}
+	if loads, ok := p.peers.(*consistenthash.BoundedMap); ok {
+		h.loads = loads
+	}
+	return h
+}
+
+// BeginLoad counts a load by the current process as a request in
+// progress to it, if the pool bounds the loads of peers. It implements
+// groupcache.LoadCounter.
+func (p *HTTPPool) BeginLoad() (done func()) {
+	p.mu.Lock()
+	loads, ok := p.peers.(*consistenthash.BoundedMap)
+	p.mu.Unlock()
+	if !ok {
+		return func() {}
+	}
+	loads.Inc(p.self)
+	return func() { loads.Done(p.self) }
+}
+
+// AddPeers adds peers to the pool, keeping the peers already in it.
+// Peers already in the pool are ignored.
+func (p *HTTPPool) AddPeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	added := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		if _, ok := p.httpGetters[peer]; ok {
+			continue
+		}
+		p.httpGetters[peer] = p.newGetter(peer)
+		added = append(added, peer)
+	}
+	p.peers.Add(added...)
+}
+
+// AddWeightedPeers is like AddPeers, but gives the added peers shares
+// of the keys proportional to their weights, as SetWeighted does.
+func (p *HTTPPool) AddWeightedPeers(peers map[string]int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	added := make(map[string]int, len(peers))
+	for peer, weight := range peers {
+		if _, ok := p.httpGetters[peer]; ok || weight < 1 {
+			continue
+		}
+		p.httpGetters[peer] = p.newGetter(peer)
+		added[peer] = weight
+	}
+	p.peers.AddWeighted(added)
+}
+
+// RemovePeers removes peers from the pool, keeping the other peers.
+// Peers not in the pool are ignored.
+func (p *HTTPPool) RemovePeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	removed := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		if _, ok := p.httpGetters[peer]; !ok {
+			continue
+		}
+		delete(p.httpGetters, peer)
+		removed = append(removed, peer)
 	}
+	p.peers.Remove(removed...)
 }
 
 func (p *HTTPPool) PickPeer(key string) (ProtoGetter, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	if peers, _ := p.pickPeers(key, 1); len(peers) > 0 {
+		return peers[0], true
+	}
+	return nil, false
+}
+
+// PickPeers returns the owner of key and the peers that take over from
+// it, as many as the Failover option allows, stopping before this
+// process. Peers whose circuit is open are skipped, and ownerSkipped
+// reports whether the owner is one of them. The Picker of the pool
+// must be a consistenthash.MultiPicker for failover.
+func (p *HTTPPool) PickPeers(key string) (peers []ProtoGetter, ownerSkipped bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pickPeers(key, 1+p.opts.Failover)
+}
+
+// pickPeers returns up to n peers for key, in order of preference,
+// stopping before this process and skipping the peers whose circuit
+// is open, and whether it skipped the owner of key. p.mu must be held.
+func (p *HTTPPool) pickPeers(key string, n int) (peers []ProtoGetter, ownerSkipped bool) {
 	if p.peers.IsEmpty() {
 		return nil, false
 	}
-	if peer := p.peers.Get(key); peer != p.self {
-		return p.httpGetters[peer], true
+	mp, multi := p.peers.(consistenthash.MultiPicker)
+	now := timeNow()
+	// Rank all the peers only if some of the first n are skipped.
+	for want := n; ; want = len(p.httpGetters) {
+		owners := []string{p.peers.Get(key)}
+		if multi {
+			owners = mp.GetN(key, want)
+		}
+		peers, ownerSkipped = nil, false
+		for i, owner := range owners {
+			if owner == p.self {
+				return peers, ownerSkipped
+			}
+			if h := p.httpGetters[owner]; h.breaker.available(now) {
+				peers = append(peers, h)
+				if len(peers) == n {
+					return peers, ownerSkipped
+				}
+			} else if i == 0 {
+				ownerSkipped = true
+			}
+		}
+		if len(owners) < want || want >= len(p.httpGetters) {
+			return peers, ownerSkipped
+		}
 	}
-	return nil, false
+}
+
+// Ring returns the pool's peers, including this process, with their
+// virtual nodes and shares of the keys. It returns nil if the pool's
+// Picker is not a consistenthash.ItemLister.
+func (p *HTTPPool) Ring() []consistenthash.Item {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if il, ok := p.peers.(consistenthash.ItemLister); ok {
+		return il.Items()
+	}
+	return nil
+}
+
+// ListPeers returns the pool's peers, excluding this process.
+func (p *HTTPPool) ListPeers() []ProtoGetter {
+	remotes := p.remotes()
+	peers := make([]ProtoGetter, len(remotes))
+	for i, h := range remotes {
+		peers[i] = h
+	}
+	return peers
 }
 
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -144,6 +405,10 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if !strings.HasPrefix(r.URL.Path, p.opts.BasePath) {
 		panic("HTTPPool serving unexpected path: " + r.URL.Path)
 	}
+	if r.URL.Path == p.opts.BasePath+healthPath {
+		w.Write([]byte("ok\n"))
+		return
+	}
 	parts := strings.SplitN(r.URL.Path[len(p.opts.BasePath):], "/", 2)
 	if len(parts) != 2 {
 		http.Error(w, "bad request", http.StatusBadRequest)
@@ -151,41 +416,139 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	groupName := parts[0]
 	key := parts[1]
-
-	// Fetch the value for this group/key.
-	group := GetGroup(groupName)
-	if group == nil {
-		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
+	if !p.authenticate(w, r, groupName) {
 		return
 	}
+	// Requests from peers load the current process like its own
+	// loads.
+	defer p.BeginLoad()()
+
 	var ctx context.Context
 	if p.Context != nil {
 		ctx = p.Context(r)
 	} else {
 		ctx = r.Context()
 	}
+	if sc, err := ParseTraceparent(r.Header.Get(traceparentHeader)); err == nil {
+		ctx = ContextWithSpanContext(ctx, sc)
+	}
+
+	switch r.Method {
+	case http.MethodDelete:
+		res := &pb.RemoveResponse{}
+		err := p.server.Remove(ctx, &pb.RemoveRequest{Group: &groupName, Key: &key}, res)
+		p.writeResult(w, res, err)
+	case http.MethodPut:
+		req := &pb.SetRequest{}
+		if !readProto(w, r, req) {
+			return
+		}
+		req.Group, req.Key = &groupName, &key
+		res := &pb.SetResponse{}
+		p.writeResult(w, res, p.server.Set(ctx, req, res))
+	case http.MethodPost:
+		req := &pb.GetMultiRequest{}
+		if !readProto(w, r, req) {
+			return
+		}
+		req.Group = &groupName
+		res := &pb.GetMultiResponse{}
+		p.writeResult(w, res, p.server.GetMulti(ctx, req, res))
+	default:
+		// Fetch the value for this group/key.
+		req := &pb.GetRequest{Group: &groupName, Key: &key}
+		if accept := r.Header.Get(acceptCodecHeader); accept != "" {
+			req.AcceptCodec = strings.Split(accept, ",")
+		}
+		if r.Header.Get(failoverHeader) != "" {
+			req.Failover = proto.Bool(true)
+		}
+		value, qps, err := p.server.get(ctx, req)
+		if err == nil && p.streams(r, value) {
+			writeStream(w, value, qps)
+			return
+		}
+		res := &pb.GetResponse{}
+		err = setGetResult(res, value, qps, err)
+		if err == nil && res.GetNotFound() {
+			// Unlike other errors, tell the caller with a message
+			// it can decode.
+			p.writeProto(w, http.StatusNotFound, res)
+			return
+		}
+		p.writeResult(w, res, err)
+	}
+}
 
-	group.Stats.ServerRequests.Add(1)
-	var value []byte
-	err := group.Get(ctx, key, AllocatingByteSliceSink(&value))
+// maxBodySize bounds the bodies of the requests that a pool reads, so
+// that a request can't exhaust its memory. It allows for the values of
+// Set requests.
+const maxBodySize = 32 << 20
+
+// readProto reads the body of r, up to maxBodySize, into m. If it
+// fails, it replies with an error and returns false.
+func readProto(w http.ResponseWriter, r *http.Request, m proto.Message) bool {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err == nil {
+		err = proto.Unmarshal(body, m)
+	}
 	if err != nil {
+		code := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), code)
+		return false
+	}
+	return true
+}
+
+// writeResult writes the response message res, or err if it is not nil.
+func (p *HTTPPool) writeResult(w http.ResponseWriter, res proto.Message, err error) {
+	switch {
+	case errors.Is(err, ErrNoGroup):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
 		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	default:
+		// Write the value to the response body as a proto message.
+		p.writeProto(w, http.StatusOK, res)
 	}
+}
 
-	// Write the value to the response body as a proto message.
-	body, err := proto.Marshal(&pb.GetResponse{Value: value})
+func (p *HTTPPool) writeProto(w http.ResponseWriter, code int, m proto.Message) {
+	body, err := proto.Marshal(m)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(code)
 	w.Write(body)
 }
 
 type httpGetter struct {
 	transport func(context.Context) http.RoundTripper
 	baseURL   string
+	peer      string // base URL of the peer, without BasePath
+
+	// loads, if not nil, records the requests in progress to peer.
+	loads *consistenthash.BoundedMap
+
+	// breaker, if not nil, is the circuit breaker of the peer.
+	breaker *breaker
+
+	// secret, if not empty, signs the requests.
+	secret []byte
+}
+
+// String returns the base URL of the peer.
+func (h *httpGetter) String() string {
+	if h.peer == "" {
+		return h.baseURL
+	}
+	return h.peer
 }
 
 var bufferPool = sync.Pool{
@@ -193,33 +556,113 @@ var bufferPool = sync.Pool{
 }
 
 func (h *httpGetter) Get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	var header http.Header
+	if accept := in.GetAcceptCodec(); len(accept) > 0 {
+		// A GET has no body: send the codecs in a header.
+		header = http.Header{acceptCodecHeader: {strings.Join(accept, ",")}}
+	}
+	if in.GetFailover() {
+		if header == nil {
+			header = http.Header{}
+		}
+		header.Set(failoverHeader, "1")
+	}
+	return h.do(ctx, "GET", in.GetGroup(), in.GetKey(), header, nil, out)
+}
+
+func (h *httpGetter) Remove(ctx context.Context, in *pb.RemoveRequest, out *pb.RemoveResponse) error {
+	return h.do(ctx, "DELETE", in.GetGroup(), in.GetKey(), nil, nil, out)
+}
+
+func (h *httpGetter) Set(ctx context.Context, in *pb.SetRequest, out *pb.SetResponse) error {
+	return h.do(ctx, "PUT", in.GetGroup(), in.GetKey(), nil, in, out)
+}
+
+func (h *httpGetter) GetMulti(ctx context.Context, in *pb.GetMultiRequest, out *pb.GetMultiResponse) error {
+	return h.do(ctx, "POST", in.GetGroup(), "", nil, in, out)
+}
+
+// do sends a request for the given group and key to the peer, with the
+// given header and with in as the request body if non-nil, and decodes
+// the response body into out.
+func (h *httpGetter) do(ctx context.Context, method, group, key string, header http.Header, in, out proto.Message) error {
 	u := fmt.Sprintf(
 		"%v%v/%v",
 		h.baseURL,
-		url.QueryEscape(in.GetGroup()),
-		url.QueryEscape(in.GetKey()),
+		url.QueryEscape(group),
+		url.QueryEscape(key),
 	)
-	req, err := http.NewRequest("GET", u, nil)
+	var body io.Reader
+	var reqBody []byte
+	if in != nil {
+		var err error
+		if reqBody, err = proto.Marshal(in); err != nil {
+			return err
+		}
+		body = bytes.NewReader(reqBody)
+	}
+	req, err := http.NewRequest(method, u, body)
 	if err != nil {
 		return err
 	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		req.Header.Set(traceparentHeader, sc.Traceparent())
+	}
+	if len(h.secret) > 0 {
+		signRequest(req, h.secret, reqBody)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+	}
+	gres, stream := out.(*pb.GetResponse)
+	if stream {
+		req.Header.Set("Accept", "application/x-protobuf, "+streamContentType)
+	}
 	req = req.WithContext(ctx)
+	if h.loads != nil {
+		h.loads.Inc(h.peer)
+		defer h.loads.Done(h.peer)
+	}
 	tr := http.DefaultTransport
 	if h.transport != nil {
 		tr = h.transport(ctx)
 	}
+	if h.breaker != nil && !h.breaker.allow(timeNow()) {
+		return errCircuitOpen
+	}
 	res, err := tr.RoundTrip(req)
 	if err != nil {
+		h.record(ctx, err)
 		return err
 	}
 	defer res.Body.Close()
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned: %v", res.Status)
+	// A not found response carries a message, unlike other errors
+	// and missing groups.
+	notFound := res.StatusCode == http.StatusNotFound &&
+		res.Header.Get("Content-Type") == "application/x-protobuf"
+	if res.StatusCode != http.StatusOK && !notFound {
+		err := fmt.Errorf("server returned: %v", res.Status)
+		if unavailable(res.StatusCode) {
+			h.record(ctx, err)
+		} else {
+			// The peer answered, if only with the error of a load.
+			h.record(ctx, nil)
+		}
+		return err
+	}
+	if stream && res.Header.Get("Content-Type") == streamContentType {
+		err := readStream(res, gres)
+		h.record(ctx, err)
+		return err
 	}
 	b := bufferPool.Get().(*bytes.Buffer)
 	b.Reset()
 	defer bufferPool.Put(b)
 	_, err = io.Copy(b, res.Body)
+	h.record(ctx, err)
 	if err != nil {
 		return fmt.Errorf("reading response body: %v", err)
 	}
@@ -17,19 +17,38 @@ limitations under the License.
 package groupcache
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
 	"errors"
 	"flag"
+	"io"
 	"log"
+	"math/big"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/golang/groupcache/consistenthash"
+	pb "github.com/golang/groupcache/groupcachepb"
 )
 
 var (
@@ -103,6 +122,1116 @@ func TestHTTPPool(t *testing.T) {
 	}
 }
 
+func TestHTTPPoolRemove(t *testing.T) {
+	var fills int
+	r, peer := newTestPool(t)
+	g := r.newGroup("TestHTTPPoolRemove-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		fills++
+		return dest.SetString("value:" + key)
+	}), NoPeers{}, nil)
+
+	get := func() {
+		res := &pb.GetResponse{}
+		req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("k")}
+		if err := peer.Get(context.TODO(), req, res); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(res.GetValue()), "value:k"; got != want {
+			t.Errorf("Get = %q; want %q", got, want)
+		}
+	}
+	get()
+	get()
+	if fills != 1 {
+		t.Fatalf("fills = %d before Remove; want 1", fills)
+	}
+
+	req := &pb.RemoveRequest{Group: proto.String(g.Name()), Key: proto.String("k")}
+	if err := peer.Remove(context.TODO(), req, &pb.RemoveResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	get()
+	if fills != 2 {
+		t.Errorf("fills = %d after Remove; want 2", fills)
+	}
+}
+
+func TestHTTPPoolSet(t *testing.T) {
+	r, peer := newTestPool(t)
+	g := r.newGroup("TestHTTPPoolSet-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return errors.New("unexpected load")
+	}), NoPeers{}, nil)
+
+	expire := time.Now().Add(time.Hour)
+	req := &pb.SetRequest{
+		Group:  proto.String(g.Name()),
+		Key:    proto.String("k"),
+		Value:  []byte("v"),
+		Expire: proto.Int64(expire.UnixNano()),
+	}
+	if err := peer.Set(context.TODO(), req, &pb.SetResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	var v ByteView
+	if err := g.Get(context.TODO(), "k", ByteViewSink(&v)); err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "v" {
+		t.Errorf("Get = %q; want %q", v.String(), "v")
+	}
+	if !v.Expire().Equal(expire) {
+		t.Errorf("Expire() = %v; want %v", v.Expire(), expire)
+	}
+	// Request bodies are bounded, signed or not.
+	p := NewHTTPPoolOpts("", &HTTPPoolOptions{Registry: NewRegistry()})
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("PUT", defaultBasePath+g.Name()+"/k", bytes.NewReader(make([]byte, maxBodySize+1))))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Set with a body over %d bytes: %v; want 413", maxBodySize, w.Code)
+	}
+}
+
+func TestHTTPPoolGetMulti(t *testing.T) {
+	r, peer := newTestPool(t)
+	g := r.newGroup("TestHTTPPoolGetMulti-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		if key == "bad" {
+			return errors.New("bad key")
+		}
+		return dest.SetString("value:" + key)
+	}), NoPeers{}, nil)
+
+	req := &pb.GetMultiRequest{
+		Group: proto.String(g.Name()),
+		Key:   []string{"a", "bad", "b", "a"},
+	}
+	res := &pb.GetMultiResponse{}
+	if err := peer.GetMulti(context.TODO(), req, res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Response) != len(req.Key) {
+		t.Fatalf("got %d responses; want %d", len(res.Response), len(req.Key))
+	}
+	for i, key := range req.Key {
+		r := res.Response[i]
+		if key == "bad" {
+			if r.GetError() == "" {
+				t.Errorf("response for %q has no error", key)
+			}
+			continue
+		}
+		if got, want := string(r.GetValue()), "value:"+key; got != want || r.Error != nil {
+			t.Errorf("response for %q = %q, %q; want %q", key, got, r.GetError(), want)
+		}
+	}
+}
+
+func TestHTTPPoolNotFound(t *testing.T) {
+	r, peer := newTestPool(t)
+	g := r.newGroup("TestHTTPPoolNotFound-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return ErrNotFound
+	}), NoPeers{}, nil)
+
+	res := &pb.GetResponse{}
+	req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("k")}
+	if err := peer.Get(context.TODO(), req, res); err != nil {
+		t.Fatal(err)
+	}
+	if !res.GetNotFound() {
+		t.Error("GetResponse.NotFound = false; want true")
+	}
+
+	// A missing group is still an error.
+	req.Group = proto.String("TestHTTPPoolNotFound-no-such-group")
+	if err := peer.Get(context.TODO(), req, &pb.GetResponse{}); err == nil {
+		t.Error("Get for missing group succeeded; want error")
+	}
+}
+
+func TestHTTPPoolClosedGroup(t *testing.T) {
+	r, peer := newTestPool(t)
+	g := r.NewGroup("TestHTTPPoolClosedGroup-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value:" + key)
+	}))
+
+	req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("k")}
+	if err := peer.Get(context.TODO(), req, &pb.GetResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	g.Close()
+	err := peer.Get(context.TODO(), req, &pb.GetResponse{})
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Get after Close error = %v; want 404", err)
+	}
+}
+
+func TestHTTPPoolExpire(t *testing.T) {
+	expire := time.Now().Add(time.Hour)
+	r, peer := newTestPool(t)
+	g := r.newGroup("TestHTTPPoolExpire-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		dest.SetExpire(expire)
+		return dest.SetString("value:" + key)
+	}), NoPeers{}, nil)
+
+	res := &pb.GetResponse{}
+	req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("k")}
+	if err := peer.Get(context.TODO(), req, res); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := res.GetExpire(), expire.UnixNano(); got != want {
+		t.Errorf("GetResponse.Expire = %d; want %d", got, want)
+	}
+}
+
+func TestHTTPPoolMinuteQPS(t *testing.T) {
+	r, peer := newTestPool(t)
+	g := r.newGroup("TestHTTPPoolMinuteQPS-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value:" + key)
+	}), NoPeers{}, nil)
+
+	res := &pb.GetResponse{}
+	req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("k")}
+	if err := peer.Get(context.TODO(), req, res); err != nil {
+		t.Fatal(err)
+	}
+	if res.MinuteQps == nil || res.GetMinuteQps() <= 0 {
+		t.Errorf("GetResponse.MinuteQps = %v; want > 0", res.MinuteQps)
+	}
+}
+
+// contentTypes records the content types of the responses of a
+// RoundTripper.
+type contentTypes []string
+
+func (c *contentTypes) transport(context.Context) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		res, err := http.DefaultTransport.RoundTrip(req)
+		if err == nil {
+			*c = append(*c, res.Header.Get("Content-Type"))
+		}
+		return res, err
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestHTTPPoolStream(t *testing.T) {
+	expire := time.Now().Add(time.Hour)
+	r := NewRegistry()
+	ts := httptest.NewServer(NewHTTPPoolOpts("", &HTTPPoolOptions{Registry: r, StreamThreshold: 200}))
+	defer ts.Close()
+	g := r.newGroup("TestHTTPPoolStream-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		dest.SetExpire(expire)
+		return dest.SetString(strings.Repeat(key, 100))
+	}), NoPeers{}, nil)
+
+	var types contentTypes
+	peer := &httpGetter{transport: types.transport, baseURL: ts.URL + defaultBasePath}
+	for _, key := range []string{"k", "large"} {
+		res := &pb.GetResponse{}
+		req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String(key)}
+		if err := peer.Get(context.TODO(), req, res); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(res.GetValue()), strings.Repeat(key, 100); got != want {
+			t.Errorf("Get(%q) = %q; want %q", key, got, want)
+		}
+		if got, want := res.GetExpire(), expire.UnixNano(); got != want {
+			t.Errorf("Get(%q) Expire = %d; want %d", key, got, want)
+		}
+		if res.GetMinuteQps() <= 0 {
+			t.Errorf("Get(%q) MinuteQps = %v; want > 0", key, res.GetMinuteQps())
+		}
+	}
+	if want := []string{"application/x-protobuf", streamContentType}; !reflect.DeepEqual([]string(types), want) {
+		t.Errorf("response content types = %q; want %q", types, want)
+	}
+
+	// Clients that don't ask for streams get messages.
+	res, err := http.Get(ts.URL + defaultBasePath + g.Name() + "/large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "application/x-protobuf" {
+		t.Errorf("response to an old client has content type %q", ct)
+	}
+}
+
+// TestReadStreamContentLength tests that readStream doesn't allocate
+// what a response's Content-Length claims before reading the value.
+func TestReadStreamContentLength(t *testing.T) {
+	stream := func(length int64, body []byte) (*pb.GetResponse, error) {
+		res := &http.Response{
+			ContentLength: length,
+			Header:        http.Header{},
+			Body:          io.NopCloser(bytes.NewReader(body)),
+		}
+		out := &pb.GetResponse{}
+		return out, readStream(res, out)
+	}
+	if _, err := stream(1<<62, []byte("short")); err == nil {
+		t.Error("readStream accepted a value shorter than its Content-Length")
+	}
+	large := bytes.Repeat([]byte("x"), maxStreamPrealloc+1)
+	if out, err := stream(int64(len(large)), large); err != nil || !bytes.Equal(out.Value, large) {
+		t.Errorf("readStream of %d bytes = %d bytes, %v", len(large), len(out.GetValue()), err)
+	}
+}
+
+func TestHTTPPoolCodec(t *testing.T) {
+	codec := GzipCodec(gzip.BestSpeed)
+	r := NewRegistry()
+	ts := httptest.NewServer(NewHTTPPoolOpts("", &HTTPPoolOptions{Registry: r, StreamThreshold: 200}))
+	defer ts.Close()
+	r.newGroup("TestHTTPPoolCodec-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString(strings.Repeat(key, 100))
+	}), NoPeers{}, &GroupOptions{Codec: codec})
+
+	var types contentTypes
+	peer := &httpGetter{transport: types.transport, baseURL: ts.URL + defaultBasePath}
+	g := newGroup("TestHTTPPoolCodec-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return errors.New("loaded locally")
+	}), fakePeers{peer}, &GroupOptions{Codec: codec, HotKeyQPS: 1e-9})
+	for _, key := range []string{"k", "large"} { // a message, then a stream
+		var s string
+		if err := g.Get(context.TODO(), key, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+		if want := strings.Repeat(key, 100); s != want {
+			t.Errorf("Get(%q) = %q; want %q", key, s, want)
+		}
+	}
+	if want := []string{"application/x-protobuf", streamContentType}; !reflect.DeepEqual([]string(types), want) {
+		t.Errorf("response content types = %q; want %q", types, want)
+	}
+	if n := g.CacheStats(HotCache).Bytes; n == 0 || n >= 600 {
+		t.Errorf("hotCache holds %d bytes; want the values compressed", n)
+	}
+
+	// Peers without the codec get raw values.
+	res := &pb.GetResponse{}
+	req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("large")}
+	if err := peer.Get(context.TODO(), req, res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Codec != nil || string(res.GetValue()) != strings.Repeat("large", 100) {
+		t.Errorf("Get without codecs returned %d bytes encoded by %q", len(res.GetValue()), res.GetCodec())
+	}
+}
+
+func TestHTTPPoolSecret(t *testing.T) {
+	r := NewRegistry()
+	ts := httptest.NewServer(NewHTTPPoolOpts("", &HTTPPoolOptions{Registry: r, Secret: []byte("secret")}))
+	defer ts.Close()
+	g := r.newGroup("TestHTTPPoolSecret-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value:" + key)
+	}), NoPeers{}, nil)
+
+	get := func(secret string) error {
+		peer := &httpGetter{baseURL: ts.URL + defaultBasePath, secret: []byte(secret)}
+		req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("k")}
+		return peer.Get(context.TODO(), req, &pb.GetResponse{})
+	}
+	if err := get("secret"); err != nil {
+		t.Errorf("signed Get: %v", err)
+	}
+	// A batch is signed with its body.
+	peer := &httpGetter{baseURL: ts.URL + defaultBasePath, secret: []byte("secret")}
+	req := &pb.GetMultiRequest{Group: proto.String(g.Name()), Key: []string{"a", "b"}}
+	if err := peer.GetMulti(context.TODO(), req, &pb.GetMultiResponse{}); err != nil {
+		t.Errorf("signed GetMulti: %v", err)
+	}
+	if err := get("wrong"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Get signed with the wrong secret: %v; want 401", err)
+	}
+	if err := get(""); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("unsigned Get: %v; want 401", err)
+	}
+	old, err := http.NewRequest("GET", ts.URL+defaultBasePath+g.Name()+"/k", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Add(-time.Hour)
+	timeNow = func() time.Time { return now }
+	signRequest(old, []byte("secret"), nil)
+	timeNow = time.Now
+	res, err := http.DefaultClient.Do(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Get with an old signature: %v; want 401", res.Status)
+	}
+	if n := g.Stats.AuthRejects.Get(); n != 3 {
+		t.Errorf("AuthRejects = %d; want 3", n)
+	}
+
+	// The body read to check a signature is bounded.
+	body := make([]byte, maxBodySize+1)
+	large := httptest.NewRequest("PUT", defaultBasePath+g.Name()+"/k", bytes.NewReader(body))
+	signRequest(large, []byte("secret"), body)
+	if verifyRequest(httptest.NewRecorder(), large, []byte("secret")) {
+		t.Errorf("verifyRequest accepted a body of %d bytes", len(body))
+	}
+
+	// Health checks need no signature.
+	if err := (&httpGetter{baseURL: ts.URL + defaultBasePath}).checkHealth(context.TODO()); err != nil {
+		t.Errorf("checkHealth: %v", err)
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Flags != 1 || sc.TraceID[0] != 0x4b || sc.SpanID[7] != 0xb7 {
+		t.Errorf("ParseTraceparent(%q) = %+v", tp, sc)
+	}
+	if got := sc.Traceparent(); got != tp {
+		t.Errorf("Traceparent = %q; want %q", got, tp)
+	}
+	if _, err := ParseTraceparent("01" + tp[2:] + "-future"); err != nil {
+		t.Errorf("later version: %v", err)
+	}
+	for _, bad := range []string{
+		"",
+		tp + "-future",
+		"ff" + tp[2:],
+		strings.ToUpper(tp),
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceparent(bad); err == nil {
+			t.Errorf("ParseTraceparent(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestHTTPPoolTraceparent(t *testing.T) {
+	r := NewRegistry()
+	ts := httptest.NewServer(NewHTTPPoolOpts("", &HTTPPoolOptions{Registry: r}))
+	defer ts.Close()
+	tr := new(testTracer)
+	g := r.newGroup("TestHTTPPoolTraceparent-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value")
+	}), NoPeers{}, &GroupOptions{Tracer: tr})
+
+	sc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := ContextWithSpanContext(context.Background(), sc)
+	peer := &httpGetter{baseURL: ts.URL + defaultBasePath}
+	req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("k")}
+	if err := peer.Get(ctx, req, &pb.GetResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	spans := tr.ended()
+	get := spans[len(spans)-1]
+	if get.name != "groupcache.Get" || get.parent != sc {
+		t.Errorf("peer span %s has parent %v; want groupcache.Get with parent %v", get.name, get.parent, sc)
+	}
+}
+
+// newCert returns a certificate for the given host, signed by parent
+// or self-signed if parent is nil.
+func newCert(t *testing.T, host string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{host},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, interface{}(key)
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(crand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestHTTPPoolClientCert(t *testing.T) {
+	ca := newCert(t, "ca", nil)
+	cas := x509.NewCertPool()
+	cas.AddCert(ca.Leaf)
+
+	r := NewRegistry()
+	p := NewHTTPPoolOpts("https://self.example", &HTTPPoolOptions{Registry: r, VerifyClientCert: true})
+	p.Set("https://self.example", "https://peer.example:8443")
+	ts := httptest.NewUnstartedServer(p)
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: cas}
+	ts.StartTLS()
+	defer ts.Close()
+	g := r.newGroup("TestHTTPPoolClientCert-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value:" + key)
+	}), NoPeers{}, nil)
+
+	get := func(host string) error {
+		tr := ts.Client().Transport.(*http.Transport).Clone()
+		tr.TLSClientConfig.Certificates = []tls.Certificate{newCert(t, host, &ca)}
+		peer := &httpGetter{
+			transport: func(context.Context) http.RoundTripper { return tr },
+			baseURL:   ts.URL + defaultBasePath,
+		}
+		req := &pb.GetRequest{Group: proto.String(g.Name()), Key: proto.String("k")}
+		return peer.Get(context.TODO(), req, &pb.GetResponse{})
+	}
+	if err := get("peer.example"); err != nil {
+		t.Errorf("Get from a peer: %v", err)
+	}
+	if err := get("stranger.example"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Get from a stranger: %v; want 403", err)
+	}
+	if n := g.Stats.AuthRejects.Get(); n != 1 {
+		t.Errorf("AuthRejects = %d; want 1", n)
+	}
+}
+
+// newTestPool returns a new Registry with an HTTPPool served by a
+// test server, and a peer that sends requests to that server.
+func newTestPool(t *testing.T) (*Registry, *httpGetter) {
+	r := NewRegistry()
+	p := NewHTTPPoolOpts("", &HTTPPoolOptions{Registry: r})
+	ts := httptest.NewServer(p)
+	t.Cleanup(ts.Close)
+	return r, &httpGetter{baseURL: ts.URL + defaultBasePath}
+}
+
+func TestHTTPPoolRegistries(t *testing.T) {
+	var peers []*httpGetter
+	for i := 0; i < 2; i++ {
+		i := i
+		r, peer := newTestPool(t)
+		r.NewGroup("TestHTTPPoolRegistries-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+			return dest.SetString(strconv.Itoa(i) + ":" + key)
+		}))
+		peers = append(peers, peer)
+	}
+	for i, peer := range peers {
+		res := &pb.GetResponse{}
+		req := &pb.GetRequest{Group: proto.String("TestHTTPPoolRegistries-group"), Key: proto.String("k")}
+		if err := peer.Get(context.TODO(), req, res); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(res.GetValue()), strconv.Itoa(i)+":k"; got != want {
+			t.Errorf("registry %d: Get = %q; want %q", i, got, want)
+		}
+	}
+}
+
+// TestHTTPPoolServerStart tests that a pool may be created when the
+// first group starts the server.
+func TestHTTPPoolServerStart(t *testing.T) {
+	r := NewRegistry()
+	var p *HTTPPool
+	r.RegisterServerStart(func() {
+		p = NewHTTPPoolOpts("http://self", &HTTPPoolOptions{Registry: r})
+	})
+	r.RegisterNewGroupHook(func(g *Group) {
+		r.GetGroup(g.Name())
+	})
+	done := make(chan *Group)
+	go func() {
+		done <- r.NewGroup("TestHTTPPoolServerStart-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+			return dest.SetString("value")
+		}))
+	}()
+	select {
+	case g := <-done:
+		g.peersOnce.Do(g.initPeers)
+		if g.peers != p {
+			t.Errorf("group peers = %v; want the pool created at server start", g.peers)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("NewGroup deadlocked creating a pool at server start")
+	}
+}
+
+func TestHTTPPoolAddRemovePeers(t *testing.T) {
+	p := NewHTTPPoolOpts("http://a", &HTTPPoolOptions{Registry: NewRegistry()})
+	p.Set("http://a", "http://b")
+	b := p.httpGetters["http://b"]
+
+	p.AddPeers("http://b", "http://c", "http://c")
+	if p.httpGetters["http://b"] != b {
+		t.Error("AddPeers replaced the getter of a peer already in the pool")
+	}
+	if n := len(p.ListPeers()); n != 2 {
+		t.Errorf("ListPeers after AddPeers returned %d peers; want 2", n)
+	}
+
+	// Keys owned by the remaining peers don't move.
+	owners := make(map[string]ProtoGetter)
+	for _, key := range testKeys(100) {
+		owners[key], _ = p.PickPeer(key)
+	}
+	c := p.httpGetters["http://c"]
+	p.RemovePeers("http://c", "http://d")
+	for key, owner := range owners {
+		peer, ok := p.PickPeer(key)
+		if ok && peer == ProtoGetter(c) {
+			t.Errorf("key %q picked the removed peer", key)
+		}
+		if owner != ProtoGetter(c) && peer != owner {
+			t.Errorf("key %q moved after RemovePeers", key)
+		}
+	}
+	if n := len(p.ListPeers()); n != 1 {
+		t.Errorf("ListPeers after RemovePeers returned %d peers; want 1", n)
+	}
+}
+
+func TestHTTPPoolSetWeighted(t *testing.T) {
+	p := NewHTTPPoolOpts("http://a", &HTTPPoolOptions{Registry: NewRegistry()})
+	p.SetWeighted(map[string]int{"http://a": 1, "http://b": 8, "http://c": 0})
+	if _, ok := p.httpGetters["http://c"]; ok {
+		t.Error("SetWeighted kept a peer of weight 0")
+	}
+	remote := 0
+	keys := testKeys(1000)
+	for _, key := range keys {
+		if _, ok := p.PickPeer(key); ok {
+			remote++
+		}
+	}
+	if share := float64(remote) / float64(len(keys)); share < 0.8 {
+		t.Errorf("peer of weight 8 of 9 owns %.2f of the keys; want about 0.89", share)
+	}
+
+	p.AddWeightedPeers(map[string]int{"http://c": 8})
+	if n := len(p.ListPeers()); n != 2 {
+		t.Errorf("ListPeers after AddWeightedPeers returned %d peers; want 2", n)
+	}
+}
+
+func TestHTTPPoolPickPeers(t *testing.T) {
+	p := NewHTTPPoolOpts("http://a", &HTTPPoolOptions{Registry: NewRegistry(), Failover: 1})
+	p.Set("http://a", "http://b", "http://c")
+	ring := p.peers.(*consistenthash.Map)
+	for _, key := range testKeys(100) {
+		peers, skipped := p.PickPeers(key)
+		owners := ring.GetN(key, 2)
+		want := 0
+		for _, owner := range owners {
+			if owner == "http://a" {
+				break
+			}
+			want++
+		}
+		if len(peers) != want {
+			t.Fatalf("PickPeers(%q) returned %d peers; want %d for owners %v", key, len(peers), want, owners)
+		}
+		for i, peer := range peers {
+			if peer != ProtoGetter(p.httpGetters[owners[i]]) {
+				t.Errorf("PickPeers(%q)[%d] isn't %s", key, i, owners[i])
+			}
+		}
+		if peer, ok := p.PickPeer(key); ok != (len(peers) > 0) || ok && peer != peers[0] {
+			t.Errorf("PickPeers(%q) doesn't start with PickPeer's peer", key)
+		}
+		if skipped {
+			t.Errorf("PickPeers(%q) skipped the owner of a key whose circuits are closed", key)
+		}
+	}
+
+	// The keys of a peer whose circuit is open go to the next peer,
+	// which takes over from the owner.
+	p.httpGetters["http://b"].breaker.trip(timeNow())
+	for _, key := range testKeys(100) {
+		owners := ring.GetN(key, 3)
+		if owners[0] != "http://b" {
+			continue
+		}
+		peers, skipped := p.PickPeers(key)
+		if !skipped {
+			t.Errorf("PickPeers(%q) didn't skip its owner, whose circuit is open", key)
+		}
+		if want := owners[1] == "http://c"; want != (len(peers) == 1 && peers[0] == ProtoGetter(p.httpGetters["http://c"])) {
+			t.Errorf("PickPeers(%q) = %v for owners %v", key, peers, owners)
+		}
+	}
+}
+
+// TestHTTPPoolFailover tests that the peer that takes over a key from
+// its dead owner loads it, rather than waiting for the owner again.
+func TestHTTPPoolFailover(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	var deadHits int32
+	handlers := map[string]http.Handler{
+		"a": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&deadHits, 1)
+			time.Sleep(delay)
+			http.Error(w, "timeout", http.StatusGatewayTimeout)
+		}),
+	}
+	transport := func(context.Context) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			w := httptest.NewRecorder()
+			handlers[req.URL.Host].ServeHTTP(w, req)
+			return w.Result(), nil
+		})
+	}
+	groups := map[string]*Group{}
+	var pools []*HTTPPool
+	for _, name := range []string{"b", "c"} {
+		name := name
+		r := NewRegistry()
+		p := NewHTTPPoolOpts("http://"+name, &HTTPPoolOptions{Registry: r, Failover: 1})
+		p.Transport = transport
+		p.Set("http://a", "http://b", "http://c")
+		handlers[name] = p
+		pools = append(pools, p)
+		groups[name] = r.NewGroup("TestHTTPPoolFailover-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+			return dest.SetString(name + ":" + key)
+		}))
+	}
+	var keys []string
+	for _, k := range testKeys(1000) {
+		if reflect.DeepEqual(pools[1].peers.(*consistenthash.Map).GetN(k, 2), []string{"http://a", "http://b"}) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) < 3 {
+		t.Fatalf("found %d keys owned by a, then b; want 3", len(keys))
+	}
+	key := keys[0]
+
+	start := time.Now()
+	var s string
+	if err := groups["c"].Get(context.TODO(), key, StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+	if s != "b:"+key {
+		t.Errorf("Get = %q; want b's value", s)
+	}
+	if n := atomic.LoadInt32(&deadHits); n != 1 || elapsed >= 2*delay {
+		t.Errorf("the dead owner got %d requests and Get took %v; want 1 request in less than %v", n, elapsed, 2*delay)
+	}
+
+	// Once the owner's circuit is open, the next peer is sent failover
+	// requests, for single keys and batches.
+	pools[1].httpGetters["http://a"].breaker.trip(timeNow())
+	if err := groups["c"].Get(context.TODO(), keys[1], StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	if s != "b:"+keys[1] {
+		t.Errorf("Get = %q; want b's value", s)
+	}
+	if err := groups["c"].GetMulti(context.TODO(), keys[2:3], func(string) Sink { return StringSink(&s) }); err != nil {
+		t.Fatal(err)
+	}
+	if s != "b:"+keys[2] {
+		t.Errorf("GetMulti = %q; want b's value", s)
+	}
+	if n := atomic.LoadInt32(&deadHits); n != 1 {
+		t.Errorf("the dead owner got %d requests; want none once its circuit is open", n-1)
+	}
+}
+
+func TestHTTPPoolNewPicker(t *testing.T) {
+	p := NewHTTPPoolOpts("http://a", &HTTPPoolOptions{
+		Registry:  NewRegistry(),
+		NewPicker: func() consistenthash.Picker { return consistenthash.NewJump(nil) },
+	})
+	p.Set("http://a", "http://b")
+	if _, ok := p.peers.(*consistenthash.Jump); !ok {
+		t.Fatalf("pool picks peers with a %T; want a *consistenthash.Jump", p.peers)
+	}
+	remote := 0
+	keys := testKeys(1000)
+	for _, key := range keys {
+		if peer, ok := p.PickPeer(key); ok {
+			if peer != ProtoGetter(p.httpGetters["http://b"]) {
+				t.Fatalf("PickPeer(%q) picked an unknown peer", key)
+			}
+			remote++
+		}
+	}
+	if remote == 0 || remote == len(keys) {
+		t.Errorf("PickPeer picked the remote peer for %d of %d keys", remote, len(keys))
+	}
+}
+
+func TestHTTPPoolBoundedLoad(t *testing.T) {
+	p := NewHTTPPoolOpts("http://a", &HTTPPoolOptions{Registry: NewRegistry(), BoundedLoad: 0.25})
+	p.Set("http://b", "http://c")
+	if !p.server.LoadLocally {
+		t.Error("pool with bounded loads forwards the keys it receives")
+	}
+	owner, _ := p.PickPeer("k")
+	loads := p.peers.(*consistenthash.BoundedMap)
+	peer := strings.TrimSuffix(owner.(*httpGetter).baseURL, defaultBasePath)
+	for i := 0; i < 10; i++ {
+		loads.Inc(peer)
+	}
+	if other, _ := p.PickPeer("k"); other == owner {
+		t.Errorf("PickPeer picked the loaded owner %s", peer)
+	}
+	for i := 0; i < 10; i++ {
+		loads.Done(peer)
+	}
+	if again, _ := p.PickPeer("k"); again != owner {
+		t.Errorf("PickPeer didn't pick the owner %s once it was done", peer)
+	}
+}
+
+func TestHTTPPoolBoundedLoadSelf(t *testing.T) {
+	r := NewRegistry()
+	p := NewHTTPPoolOpts("http://a", &HTTPPoolOptions{Registry: r, BoundedLoad: 0.25})
+	p.Set("http://a", "http://b", "http://c")
+	loads := p.peers.(*consistenthash.BoundedMap)
+	var self string
+	for _, key := range testKeys(100) {
+		if _, ok := p.PickPeer(key); !ok {
+			self = key
+			break
+		}
+	}
+
+	// Local loads and requests from peers count once each.
+	var seen []int64
+	g := r.NewGroup("TestHTTPPoolBoundedLoadSelf-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		seen = append(seen, loads.Load("http://a"))
+		return dest.SetString("value")
+	}))
+	var s string
+	if err := g.Get(context.TODO(), self, StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", defaultBasePath+g.Name()+"/other", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("served %v", w.Code)
+	}
+	if !reflect.DeepEqual(seen, []int64{1, 1}) || loads.Load("http://a") != 0 {
+		t.Errorf("loads of self during loads = %v, after = %d; want [1 1], 0", seen, loads.Load("http://a"))
+	}
+
+	// A loaded self sends its keys to peers.
+	var dones []func()
+	for i := 0; i < 10; i++ {
+		dones = append(dones, p.BeginLoad())
+	}
+	if _, ok := p.PickPeer(self); !ok {
+		t.Errorf("PickPeer kept %q on the loaded self", self)
+	}
+	for _, done := range dones {
+		done()
+	}
+	if _, ok := p.PickPeer(self); ok {
+		t.Errorf("PickPeer didn't keep %q on self once it was done", self)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	b := &breaker{failures: 2, timeout: time.Second}
+	now := time.Now()
+	b.failure(now)
+	if !b.available(now) {
+		t.Fatal("circuit opened after 1 failure; want 2")
+	}
+	b.failure(now)
+	if b.available(now) || b.allow(now) {
+		t.Fatal("circuit still closed after 2 failures")
+	}
+
+	// Half-open: a single probe goes through.
+	now = now.Add(time.Second)
+	if !b.available(now) || !b.allow(now) {
+		t.Fatal("half-open circuit doesn't allow a probe")
+	}
+	if b.available(now) || b.allow(now) {
+		t.Fatal("half-open circuit allows a second probe")
+	}
+	b.failure(now)
+	if b.available(now) {
+		t.Fatal("circuit closed after a failed probe")
+	}
+
+	// A cancelled probe leaves the circuit to another one.
+	now = now.Add(time.Second)
+	b.allow(now)
+	b.cancel(now)
+	if b.available(now) {
+		t.Fatal("circuit closed after a cancelled probe")
+	}
+	now = now.Add(time.Second)
+	if !b.available(now) {
+		t.Fatal("circuit isn't half-open again after a cancelled probe")
+	}
+
+	b.allow(now)
+	b.success()
+	if !b.available(now) {
+		t.Fatal("circuit open after a successful probe")
+	}
+	b.failure(now)
+	if !b.available(now) {
+		t.Fatal("circuit opened after 1 failure following a success")
+	}
+}
+
+// deadPeerURL returns the URL of a server that no longer listens.
+func deadPeerURL(t *testing.T) string {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+	return ts.URL
+}
+
+func TestHTTPPoolCircuitBreaker(t *testing.T) {
+	dead := deadPeerURL(t)
+	p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{Registry: NewRegistry(), BreakerFailures: 2})
+	p.Set("http://self", dead)
+	var key string
+	for _, k := range testKeys(100) {
+		if _, ok := p.PickPeer(k); ok {
+			key = k
+			break
+		}
+	}
+	peer, _ := p.PickPeer(key)
+	req := &pb.GetRequest{Group: proto.String("group"), Key: proto.String(key)}
+	for i := 0; i < 2; i++ {
+		if err := peer.Get(context.Background(), req, &pb.GetResponse{}); err == nil {
+			t.Fatal("Get from a dead peer succeeded")
+		}
+	}
+	if _, ok := p.PickPeer(key); ok {
+		t.Error("PickPeer picked a peer whose circuit is open")
+	}
+	if err := peer.Get(context.Background(), req, &pb.GetResponse{}); err != errCircuitOpen {
+		t.Errorf("Get from an open circuit = %v; want %v", err, errCircuitOpen)
+	}
+
+	// A probe whose caller gives up doesn't keep the peer out.
+	now := time.Now().Add(defaultBreakerTimeout)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := peer.Get(ctx, req, &pb.GetResponse{}); err == nil || err == errCircuitOpen {
+		t.Fatalf("probe with a cancelled context = %v; want a request error", err)
+	}
+	now = now.Add(defaultBreakerTimeout)
+	if _, ok := p.PickPeer(key); !ok {
+		t.Error("PickPeer doesn't pick the peer once a cancelled probe times out")
+	}
+}
+
+// TestHTTPPoolCircuitBreakerResponses tests that responses of peers
+// that can't serve requests open their circuit.
+func TestHTTPPoolCircuitBreakerResponses(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"503", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}},
+		{"truncated body", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/x-protobuf")
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte("short"))
+		}},
+	} {
+		ts := httptest.NewServer(tt.handler)
+		p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{Registry: NewRegistry(), BreakerFailures: 2})
+		p.Set("http://self", ts.URL)
+		var key string
+		for _, k := range testKeys(100) {
+			if _, ok := p.PickPeer(k); ok {
+				key = k
+				break
+			}
+		}
+		peer, _ := p.PickPeer(key)
+		req := &pb.GetRequest{Group: proto.String("group"), Key: proto.String(key)}
+		for i := 0; i < 2; i++ {
+			if err := peer.Get(context.Background(), req, &pb.GetResponse{}); err == nil {
+				t.Fatalf("%s: Get succeeded", tt.name)
+			}
+		}
+		if _, ok := p.PickPeer(key); ok {
+			t.Errorf("%s: PickPeer picked a peer whose circuit should be open", tt.name)
+		}
+		ts.Close()
+	}
+}
+
+func TestHTTPPoolHealthCheck(t *testing.T) {
+	r := NewRegistry()
+	live := httptest.NewServer(NewHTTPPoolOpts("", &HTTPPoolOptions{Registry: r}))
+	defer live.Close()
+	res, err := http.Get(live.URL + defaultBasePath + "_health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("health endpoint returned %v; want 200 OK", res.Status)
+	}
+
+	dead := deadPeerURL(t)
+	p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{Registry: NewRegistry(), HealthCheckInterval: 10 * time.Millisecond})
+	defer p.Close()
+	p.Set("http://self", live.URL, dead)
+	for i := 0; p.httpGetters[dead].breaker.available(timeNow()); i++ {
+		if i == 100 {
+			t.Fatal("health checks didn't open the circuit of a dead peer")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !p.httpGetters[live.URL].breaker.available(timeNow()) {
+		t.Error("health checks opened the circuit of a live peer")
+	}
+}
+
+func TestDebugHandler(t *testing.T) {
+	r := NewRegistry()
+	p := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{Registry: r})
+	dead := deadPeerURL(t)
+	p.Set("http://self", dead)
+	// Load hot and slow locally, and remote from the dead peer.
+	var hot, slow, remote string
+	for _, key := range testKeys(100) {
+		if _, ok := p.PickPeer(key); ok {
+			if remote == "" {
+				remote = key
+			}
+		} else if hot == "" {
+			hot = key
+		} else if slow == "" {
+			slow = key
+		}
+	}
+	release := make(chan bool)
+	g := r.NewGroup("TestDebugHandler-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		if key == slow {
+			<-release
+		}
+		return dest.SetString("value:" + key)
+	}))
+
+	var s string
+	for i := 0; i < 3; i++ {
+		if err := g.Get(context.TODO(), hot, StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := g.Get(context.TODO(), remote, StringSink(&s)); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan bool)
+	go func() {
+		g.Get(context.TODO(), slow, StringSink(new(string)))
+		done <- true
+	}()
+	defer func() {
+		close(release)
+		<-done
+	}()
+	for i := 0; len(g.InFlight()) == 0; i++ {
+		if i == 1000 {
+			t.Fatal("the slow load never started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	w := httptest.NewRecorder()
+	DebugHandler(r).ServeHTTP(w, httptest.NewRequest("GET", "/groupcachez?format=json", nil))
+	var page []groupDebug
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+	if len(page) != 1 {
+		t.Fatalf("page describes %d groups; want 1", len(page))
+	}
+	d := page[0]
+	if d.Name != g.Name() || d.Stats["Gets"] != 5 || d.MainCache.Items != 2 {
+		t.Errorf("page describes %s with %d gets and %d items; want %s with 5 and 2", d.Name, d.Stats["Gets"], d.MainCache.Items, g.Name())
+	}
+	if len(d.Peers) != 2 || d.Peers[0].Name != dead || d.Peers[0].Nodes != defaultReplicas {
+		t.Errorf("page describes peers %+v", d.Peers)
+	}
+	if len(d.PeerErrors) != 1 || d.PeerErrors[0].Peer != dead || d.PeerErrors[0].Key != remote {
+		t.Errorf("page describes peer errors %+v; want one from %s for %q", d.PeerErrors, dead, remote)
+	}
+	if len(d.HotKeys) == 0 || d.HotKeys[0].Key != hot || d.HotKeys[0].Cache != MainCache {
+		t.Errorf("page describes hot keys %+v; want %q first", d.HotKeys, hot)
+	}
+	if len(d.InFlight) != 1 || d.InFlight[0] != slow {
+		t.Errorf("page describes loads in progress %q; want %q", d.InFlight, slow)
+	}
+
+	w = httptest.NewRecorder()
+	DebugHandler(r).ServeHTTP(w, httptest.NewRequest("GET", "/groupcachez", nil))
+	for _, want := range []string{"<h2>TestDebugHandler-group</h2>", "Recent peer errors", dead, "<li>" + slow + "</li>"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("HTML page lacks %q", want)
+		}
+	}
+}
+
+// TestDebugHandlerPeers tests that the debug page doesn't pick the
+// peers of a group that hasn't been used.
+func TestDebugHandlerPeers(t *testing.T) {
+	r := NewRegistry()
+	picked := 0
+	r.RegisterPeerPicker(func() PeerPicker {
+		picked++
+		return NoPeers{}
+	})
+	g := r.NewGroup("TestDebugHandlerPeers-group", 1<<20, GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		return dest.SetString("value:" + key)
+	}))
+
+	w := httptest.NewRecorder()
+	DebugHandler(r).ServeHTTP(w, httptest.NewRequest("GET", "/groupcachez", nil))
+	if picked != 0 {
+		t.Errorf("the debug page picked the peers of an unused group")
+	}
+	if !strings.Contains(w.Body.String(), "uninitialized") {
+		t.Errorf("HTML page doesn't describe the peers as uninitialized:\n%s", w.Body)
+	}
+
+	if err := g.Get(context.TODO(), "k", StringSink(new(string))); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	DebugHandler(r).ServeHTTP(w, httptest.NewRequest("GET", "/groupcachez?format=json", nil))
+	var page []groupDebug
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+	if picked != 1 || len(page) != 1 || !page[0].PeersInit {
+		t.Errorf("after a Get, peers picked %d times and page describes %+v; want 1 and initialized peers", picked, page)
+	}
+}
+
 func testKeys(n int) (keys []string) {
 	keys = make([]string, n)
 	for i := range keys {
@@ -0,0 +1,186 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package lfu implements an LFU cache.
+package lfu
+
+import "container/list"
+
+// Cache is an LFU cache. It is not safe for concurrent access.
+//
+// Entries that have been used equally often are evicted least
+// recently used first.
+type Cache struct {
+	// MaxEntries is the maximum number of cache entries before
+	// an item is evicted. Zero means no limit.
+	MaxEntries int
+
+	// OnEvicted optionally specifies a callback function to be
+	// executed when an entry is purged from the cache.
+	OnEvicted func(key Key, value interface{})
+
+	// freqs holds a *freqNode for each distinct use count, in
+	// increasing order of counts.
+	freqs *list.List
+	cache map[interface{}]*list.Element
+}
+
+// A Key may be any value that is comparable. See http://golang.org/ref/spec#Comparison_operators
+type Key interface{}
+
+type entry struct {
+	key   Key
+	value interface{}
+	freq  *list.Element // the element of freqs holding this entry
+}
+
+// A freqNode holds the entries that have been used count times, most
+// recently used first.
+type freqNode struct {
+	count   int
+	entries *list.List
+}
+
+// New creates a new Cache.
+// If maxEntries is zero, the cache has no limit and it's assumed
+// that eviction is done by the caller.
+func New(maxEntries int) *Cache {
+	return &Cache{
+		MaxEntries: maxEntries,
+		freqs:      list.New(),
+		cache:      make(map[interface{}]*list.Element),
+	}
+}
+
+// Add adds a value to the cache. Adding counts as a use of the key.
+func (c *Cache) Add(key Key, value interface{}) {
+	if c.cache == nil {
+		c.cache = make(map[interface{}]*list.Element)
+		c.freqs = list.New()
+	}
+	if ee, ok := c.cache[key]; ok {
+		ee.Value.(*entry).value = value
+		c.increment(ee)
+		return
+	}
+	// Evict before adding, as the new entry would otherwise often
+	// be the least frequently used one.
+	if c.MaxEntries != 0 && len(c.cache) >= c.MaxEntries {
+		c.RemoveLeastFrequent()
+	}
+	front := c.freqs.Front()
+	if front == nil || front.Value.(*freqNode).count != 1 {
+		front = c.freqs.PushFront(&freqNode{count: 1, entries: list.New()})
+	}
+	c.cache[key] = front.Value.(*freqNode).entries.PushFront(&entry{key, value, front})
+}
+
+// Get looks up a key's value from the cache.
+func (c *Cache) Get(key Key) (value interface{}, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if ele, hit := c.cache[key]; hit {
+		c.increment(ele)
+		return ele.Value.(*entry).value, true
+	}
+	return
+}
+
+// Peek looks up a key's value from the cache, without recording a use
+// of it.
+func (c *Cache) Peek(key Key) (value interface{}, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if ele, hit := c.cache[key]; hit {
+		return ele.Value.(*entry).value, true
+	}
+	return
+}
+
+// increment moves the entry in e to the node for the next use count.
+func (c *Cache) increment(e *list.Element) {
+	kv := e.Value.(*entry)
+	cur := kv.freq
+	node := cur.Value.(*freqNode)
+	next := cur.Next()
+	if next == nil || next.Value.(*freqNode).count != node.count+1 {
+		next = c.freqs.InsertAfter(&freqNode{count: node.count + 1, entries: list.New()}, cur)
+	}
+	node.entries.Remove(e)
+	if node.entries.Len() == 0 {
+		c.freqs.Remove(cur)
+	}
+	kv.freq = next
+	c.cache[kv.key] = next.Value.(*freqNode).entries.PushFront(kv)
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key Key) {
+	if c.cache == nil {
+		return
+	}
+	if ele, hit := c.cache[key]; hit {
+		c.removeElement(ele)
+	}
+}
+
+// RemoveLeastFrequent removes the least frequently used item from the
+// cache.
+func (c *Cache) RemoveLeastFrequent() {
+	if c.cache == nil {
+		return
+	}
+	front := c.freqs.Front()
+	if front == nil {
+		return
+	}
+	c.removeElement(front.Value.(*freqNode).entries.Back())
+}
+
+func (c *Cache) removeElement(e *list.Element) {
+	kv := e.Value.(*entry)
+	node := kv.freq.Value.(*freqNode)
+	node.entries.Remove(e)
+	if node.entries.Len() == 0 {
+		c.freqs.Remove(kv.freq)
+	}
+	delete(c.cache, kv.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// Len returns the number of items in the cache.
+func (c *Cache) Len() int {
+	if c.cache == nil {
+		return 0
+	}
+	return len(c.cache)
+}
+
+// Clear purges all stored items from the cache.
+func (c *Cache) Clear() {
+	if c.OnEvicted != nil {
+		for _, e := range c.cache {
+			kv := e.Value.(*entry)
+			c.OnEvicted(kv.key, kv.value)
+		}
+	}
+	c.freqs = nil
+	c.cache = nil
+}
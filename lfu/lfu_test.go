@@ -0,0 +1,93 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lfu
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	lfu := New(0)
+	lfu.Add("myKey", 1234)
+	if val, ok := lfu.Get("myKey"); !ok {
+		t.Fatal("cache miss for myKey")
+	} else if val != 1234 {
+		t.Fatalf("got %v for myKey; want 1234", val)
+	}
+	if _, ok := lfu.Get("nonsense"); ok {
+		t.Fatal("cache hit for nonsense")
+	}
+}
+
+func TestPeek(t *testing.T) {
+	lfu := New(2)
+	lfu.Add("a", 1)
+	lfu.Add("b", 2)
+	lfu.Get("b")
+	for i := 0; i < 3; i++ {
+		if val, ok := lfu.Peek("a"); !ok || val != 1 {
+			t.Fatalf("Peek(a) = %v, %v; want 1, true", val, ok)
+		}
+	}
+	// Peeking at a does not make it more frequently used than b.
+	lfu.Add("c", 3)
+	if _, ok := lfu.Peek("a"); ok {
+		t.Fatal("a survived eviction after Peek")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	lfu := New(0)
+	lfu.Add("myKey", 1234)
+	lfu.Remove("myKey")
+	if _, ok := lfu.Get("myKey"); ok {
+		t.Fatal("TestRemove returned a removed entry")
+	}
+	if n := lfu.Len(); n != 0 {
+		t.Fatalf("Len() = %d after Remove; want 0", n)
+	}
+}
+
+func TestEvict(t *testing.T) {
+	evictedKeys := make([]Key, 0)
+	onEvictedFun := func(key Key, value interface{}) {
+		evictedKeys = append(evictedKeys, key)
+	}
+
+	lfu := New(20)
+	lfu.OnEvicted = onEvictedFun
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("myKey%d", i)
+		lfu.Add(key, 1234)
+		// Use every key but myKey5 and myKey7 a second time.
+		if i != 5 && i != 7 {
+			lfu.Get(key)
+		}
+	}
+	lfu.Add("myKey20", 1234)
+	lfu.Add("myKey21", 1234)
+
+	// The keys used once are evicted, least recently used first.
+	want := []Key{"myKey5", "myKey7"}
+	if fmt.Sprint(evictedKeys) != fmt.Sprint(want) {
+		t.Fatalf("evicted keys = %v; want %v", evictedKeys, want)
+	}
+	if n := lfu.Len(); n != 20 {
+		t.Fatalf("Len() = %d; want 20", n)
+	}
+}
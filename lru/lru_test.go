@@ -58,6 +58,20 @@ func TestGet(t *testing.T) {
 	}
 }
 
+func TestPeek(t *testing.T) {
+	lru := New(2)
+	lru.Add("a", 1)
+	lru.Add("b", 2)
+	if val, ok := lru.Peek("a"); !ok || val != 1 {
+		t.Fatalf("Peek(a) = %v, %v; want 1, true", val, ok)
+	}
+	// Peeking at a does not make it more recently used than b.
+	lru.Add("c", 3)
+	if _, ok := lru.Peek("a"); ok {
+		t.Fatal("a survived eviction after Peek")
+	}
+}
+
 func TestRemove(t *testing.T) {
 	lru := New(0)
 	lru.Add("myKey", 1234)
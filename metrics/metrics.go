@@ -0,0 +1,304 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics exports the statistics of groupcache groups as
+// expvar variables and in the Prometheus text exposition format.
+//
+// The Prometheus metrics are named groupcache_*, with a group label
+// and, depending on the metric, cache and peer labels:
+//
+//	groupcache_gets_total{group}
+//	groupcache_cache_bytes{group,cache}
+//	groupcache_peer_request_duration_seconds{group,peer}
+//
+// Each field of groupcache.Stats is a counter, and each field of
+// groupcache.CacheStats a gauge or counter, named after the field.
+// The counters of eviction policies are
+// groupcache_cache_policy_total{group,cache,counter}.
+package metrics
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/groupcache"
+)
+
+// statsMetrics are the metrics of the fields of groupcache.Stats.
+var statsMetrics = []struct {
+	name, help string
+	field      func(*groupcache.Stats) *groupcache.AtomicInt
+}{
+	{"gets_total", "Get requests, including from peers.", func(s *groupcache.Stats) *groupcache.AtomicInt { return &s.Gets }},
+	{"cache_hits_total", "Get requests served from either cache.", func(s *groupcache.Stats) *groupcache.AtomicInt { return &s.CacheHits }},
+	{"peer_loads_total", "Values loaded from peers.", func(s *groupcache.Stats) *groupcache.AtomicInt { return &s.PeerLoads }},
+	{"peer_errors_total", "Failed loads from peers.", func(s *groupcache.Stats) *groupcache.AtomicInt { return &s.PeerErrors }},
+	{"loads_total", "Get requests that missed the caches.", func(s *groupcache.Stats) *groupcache.AtomicInt { return &s.Loads }},
+	{"loads_deduped_total", "Loads after deduplication of concurrent requests.", func(s *groupcache.Stats) *groupcache.AtomicInt { return &s.LoadsDeduped }},
+	{"local_loads_total", "Values loaded by the Getter.", func(s *groupcache.Stats) *groupcache.AtomicInt { return &s.LocalLoads }},
+	{"local_load_errors_total", "Failed loads by the Getter.", func(s *groupcache.Stats) *groupcache.AtomicInt { return &s.LocalLoadErrs }},
+	{"server_requests_total", "Requests from peers.", func(s *groupcache.Stats) *groupcache.AtomicInt { return &s.ServerRequests }},
+	{"not_founds_total", "Keys found to have no value.", func(s *groupcache.Stats) *groupcache.AtomicInt { return &s.NotFounds }},
+	{"hedges_total", "Hedged requests issued.", func(s *groupcache.Stats) *groupcache.AtomicInt { return &s.Hedges }},
+	{"hedges_won_total", "Hedged requests that answered first.", func(s *groupcache.Stats) *groupcache.AtomicInt { return &s.HedgesWon }},
+	{"auth_rejects_total", "Requests from peers that failed authentication.", func(s *groupcache.Stats) *groupcache.AtomicInt { return &s.AuthRejects }},
+}
+
+// cacheMetrics are the metrics of the fields of groupcache.CacheStats.
+var cacheMetrics = []struct {
+	name, typ, help string
+	field           func(*groupcache.CacheStats) int64
+}{
+	{"cache_bytes", "gauge", "Size of the keys and values in the cache.", func(s *groupcache.CacheStats) int64 { return s.Bytes }},
+	{"cache_items", "gauge", "Entries in the cache.", func(s *groupcache.CacheStats) int64 { return s.Items }},
+	{"cache_gets_total", "counter", "Lookups in the cache.", func(s *groupcache.CacheStats) int64 { return s.Gets }},
+	{"cache_lookup_hits_total", "counter", "Lookups that found the key in the cache.", func(s *groupcache.CacheStats) int64 { return s.Hits }},
+	{"cache_evictions_total", "counter", "Entries evicted to make room in the cache.", func(s *groupcache.CacheStats) int64 { return s.Evictions }},
+}
+
+var cacheTypes = []struct {
+	name string
+	typ  groupcache.CacheType
+}{
+	{"main", groupcache.MainCache},
+	{"hot", groupcache.HotCache},
+}
+
+// Handler returns an http.Handler that serves the metrics of the
+// groups of r in the Prometheus text exposition format. If r is nil,
+// it serves those of groupcache.DefaultRegistry.
+func Handler(r *groupcache.Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WritePrometheus(w, r)
+	})
+}
+
+// WritePrometheus writes the metrics of the groups of r to w in the
+// Prometheus text exposition format. If r is nil, it writes those of
+// groupcache.DefaultRegistry.
+func WritePrometheus(w io.Writer, r *groupcache.Registry) error {
+	groups := groupsOf(r)
+	pw := &promWriter{w: w}
+	for _, m := range statsMetrics {
+		pw.header(m.name, "counter", m.help)
+		for _, g := range groups {
+			pw.sample(m.name, labels("group", g.Name()), float64(m.field(&g.Stats).Get()))
+		}
+	}
+
+	// Read each cache's stats once, as they are copied under a lock.
+	caches := make([][]groupcache.CacheStats, len(groups))
+	for i, g := range groups {
+		for _, c := range cacheTypes {
+			caches[i] = append(caches[i], g.CacheStats(c.typ))
+		}
+	}
+	for _, m := range cacheMetrics {
+		pw.header(m.name, m.typ, m.help)
+		for i, g := range groups {
+			for j, c := range cacheTypes {
+				pw.sample(m.name, labels("group", g.Name(), "cache", c.name), float64(m.field(&caches[i][j])))
+			}
+		}
+	}
+	pw.header("cache_policy_total", "counter", "Counters of the eviction policy of the cache.")
+	for _, g := range groups {
+		for _, c := range cacheTypes {
+			policy := g.PolicyStats(c.typ)
+			for _, counter := range sortedKeys(policy) {
+				pw.sample("cache_policy_total", labels("group", g.Name(), "cache", c.name, "counter", counter), float64(policy[counter]))
+			}
+		}
+	}
+
+	peers := make([]map[string]*groupcache.PeerStats, len(groups))
+	for i, g := range groups {
+		peers[i] = g.PeerStats()
+	}
+	pw.header("peer_requests_total", "counter", "Requests sent to the peer.")
+	for i, g := range groups {
+		for _, peer := range sortedPeers(peers[i]) {
+			pw.sample("peer_requests_total", labels("group", g.Name(), "peer", peer), float64(peers[i][peer].Requests.Get()))
+		}
+	}
+	pw.header("peer_request_errors_total", "counter", "Requests sent to the peer that failed.")
+	for i, g := range groups {
+		for _, peer := range sortedPeers(peers[i]) {
+			pw.sample("peer_request_errors_total", labels("group", g.Name(), "peer", peer), float64(peers[i][peer].Errors.Get()))
+		}
+	}
+	const duration = "peer_request_duration_seconds"
+	pw.header(duration, "histogram", "Duration of the requests sent to the peer.")
+	for i, g := range groups {
+		for _, peer := range sortedPeers(peers[i]) {
+			h := &peers[i][peer].Latency
+			// Read the count last, so that it is never less
+			// than the buckets, read earlier.
+			bounds, counts := h.Buckets()
+			count := h.Count()
+			for j, le := range bounds {
+				pw.sample(duration+"_bucket", labels("group", g.Name(), "peer", peer, "le", formatFloat(le)), float64(counts[j]))
+			}
+			pw.sample(duration+"_bucket", labels("group", g.Name(), "peer", peer, "le", "+Inf"), float64(count))
+			pw.sample(duration+"_sum", labels("group", g.Name(), "peer", peer), h.Sum().Seconds())
+			pw.sample(duration+"_count", labels("group", g.Name(), "peer", peer), float64(count))
+		}
+	}
+	return pw.err
+}
+
+// promWriter writes metrics in the Prometheus text format, keeping the
+// first error.
+type promWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (pw *promWriter) header(name, typ, help string) {
+	if pw.err == nil {
+		_, pw.err = fmt.Fprintf(pw.w, "# HELP groupcache_%s %s\n# TYPE groupcache_%s %s\n", name, help, name, typ)
+	}
+}
+
+func (pw *promWriter) sample(name, labels string, value float64) {
+	if pw.err == nil {
+		_, pw.err = fmt.Fprintf(pw.w, "groupcache_%s{%s} %s\n", name, labels, formatFloat(value))
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats pairs of label names and values.
+func labels(pairs ...string) string {
+	var b strings.Builder
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", pairs[i], labelEscaper.Replace(pairs[i+1]))
+	}
+	return b.String()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedPeers(m map[string]*groupcache.PeerStats) []string {
+	peers := make([]string, 0, len(m))
+	for peer := range m {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+func groupsOf(r *groupcache.Registry) []*groupcache.Group {
+	if r == nil {
+		r = groupcache.DefaultRegistry
+	}
+	return r.Groups()
+}
+
+// Publish publishes the statistics of the groups of r as the expvar
+// variable of the given name, a JSON object keyed by group name. If r
+// is nil, it publishes those of groupcache.DefaultRegistry. Like
+// expvar.Publish, it panics if the name is already in use.
+func Publish(name string, r *groupcache.Registry) {
+	expvar.Publish(name, expvar.Func(func() interface{} { return Snapshot(r) }))
+}
+
+// GroupSnapshot holds the statistics of a group at one time.
+type GroupSnapshot struct {
+	Stats     map[string]int64
+	MainCache groupcache.CacheStats
+	HotCache  groupcache.CacheStats
+	Peers     map[string]PeerSnapshot
+
+	// Policy holds the counters of the eviction policy of each
+	// cache, keyed by cache and counter name.
+	Policy map[string]map[string]int64 `json:",omitempty"`
+}
+
+// PeerSnapshot holds the statistics of the requests that a group sent
+// to a peer, at one time.
+type PeerSnapshot struct {
+	Requests int64
+	Errors   int64
+
+	// LatencyBuckets maps upper bounds in seconds to the number of
+	// requests that took up to that long.
+	LatencyBuckets map[string]int64
+	LatencySum     float64 // in seconds
+}
+
+// Snapshot returns the statistics of the groups of r, keyed by group
+// name. The keys of GroupSnapshot.Stats are the names of the
+// Prometheus metrics, without the groupcache_ prefix. If r is nil, it
+// returns those of groupcache.DefaultRegistry.
+func Snapshot(r *groupcache.Registry) map[string]GroupSnapshot {
+	groups := groupsOf(r)
+	snap := make(map[string]GroupSnapshot, len(groups))
+	for _, g := range groups {
+		s := GroupSnapshot{
+			Stats:     make(map[string]int64, len(statsMetrics)),
+			MainCache: g.CacheStats(groupcache.MainCache),
+			HotCache:  g.CacheStats(groupcache.HotCache),
+			Peers:     make(map[string]PeerSnapshot),
+		}
+		for _, m := range statsMetrics {
+			s.Stats[m.name] = m.field(&g.Stats).Get()
+		}
+		for _, c := range cacheTypes {
+			if policy := g.PolicyStats(c.typ); len(policy) > 0 {
+				if s.Policy == nil {
+					s.Policy = make(map[string]map[string]int64)
+				}
+				s.Policy[c.name] = policy
+			}
+		}
+		for name, ps := range g.PeerStats() {
+			p := PeerSnapshot{
+				Requests:       ps.Requests.Get(),
+				Errors:         ps.Errors.Get(),
+				LatencyBuckets: make(map[string]int64),
+				LatencySum:     ps.Latency.Sum().Seconds(),
+			}
+			bounds, counts := ps.Latency.Buckets()
+			for i, le := range bounds {
+				p.LatencyBuckets[formatFloat(le)] = counts[i]
+			}
+			s.Peers[name] = p
+		}
+		snap[g.Name()] = s
+	}
+	return snap
+}
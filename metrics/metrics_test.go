@@ -0,0 +1,132 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/groupcache"
+	pb "github.com/golang/groupcache/groupcachepb"
+)
+
+// remotePeer serves the keys starting with "remote".
+type remotePeer struct{}
+
+func (remotePeer) Get(_ context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	out.Value = []byte("remote value")
+	return nil
+}
+
+func (remotePeer) String() string { return "http://peer" }
+
+func (p remotePeer) PickPeer(key string) (groupcache.ProtoGetter, bool) {
+	return p, strings.HasPrefix(key, "remote")
+}
+
+func newTestRegistry(t *testing.T) *groupcache.Registry {
+	r := groupcache.NewRegistry()
+	r.RegisterPeerPicker(func() groupcache.PeerPicker { return remotePeer{} })
+	g := r.NewGroupOpts(`a "group"`, 1<<20, groupcache.GetterFunc(func(_ context.Context, key string, dest groupcache.Sink) error {
+		return dest.SetString("local value")
+	}), &groupcache.GroupOptions{EvictionPolicy: groupcache.NewTinyLFUPolicy})
+	var s string
+	for _, key := range []string{"a", "a", "remote"} {
+		if err := g.Get(context.TODO(), key, groupcache.StringSink(&s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r
+}
+
+func TestHandler(t *testing.T) {
+	r := newTestRegistry(t)
+	w := httptest.NewRecorder()
+	Handler(r).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		"# TYPE groupcache_gets_total counter\n",
+		`groupcache_gets_total{group="a \"group\""} 3` + "\n",
+		`groupcache_cache_hits_total{group="a \"group\""} 1` + "\n",
+		"# TYPE groupcache_cache_bytes gauge\n",
+		`groupcache_cache_items{group="a \"group\"",cache="main"} 1` + "\n",
+		`groupcache_cache_policy_total{group="a \"group\"",cache="main",counter="admitted"} 0` + "\n",
+		`groupcache_peer_requests_total{group="a \"group\"",peer="http://peer"} 1` + "\n",
+		`groupcache_cache_lookup_hits_total{group="a \"group\"",cache="main"} 1` + "\n",
+		`groupcache_peer_request_errors_total{group="a \"group\"",peer="http://peer"} 0` + "\n",
+		"# TYPE groupcache_peer_request_duration_seconds histogram\n",
+		`groupcache_peer_request_duration_seconds_bucket{group="a \"group\"",peer="http://peer",le="10"} 1` + "\n",
+		`groupcache_peer_request_duration_seconds_bucket{group="a \"group\"",peer="http://peer",le="+Inf"} 1` + "\n",
+		`groupcache_peer_request_duration_seconds_count{group="a \"group\"",peer="http://peer"} 1` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %q", want)
+		}
+	}
+	if t.Failed() {
+		t.Logf("metrics:\n%s", body)
+	}
+}
+
+// TestHandlerFamilies tests that each metric family is written once,
+// as the exposition format requires.
+func TestHandlerFamilies(t *testing.T) {
+	r := newTestRegistry(t)
+	w := httptest.NewRecorder()
+	Handler(r).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if !strings.HasPrefix(line, "# TYPE ") {
+			continue
+		}
+		name := strings.Fields(line)[2]
+		if seen[name] {
+			t.Errorf("metric family %s is written twice", name)
+		}
+		seen[name] = true
+	}
+}
+
+func TestPublish(t *testing.T) {
+	r := newTestRegistry(t)
+	Publish("TestPublish", r)
+	var snap map[string]GroupSnapshot
+	if err := json.NewDecoder(bytes.NewBufferString(expvar.Get("TestPublish").String())).Decode(&snap); err != nil {
+		t.Fatal(err)
+	}
+	g, ok := snap[`a "group"`]
+	if !ok {
+		t.Fatalf("snapshot lacks the group: %v", snap)
+	}
+	if g.Stats["gets_total"] != 3 || g.MainCache.Items != 1 {
+		t.Errorf("snapshot has %d gets and %d items; want 3 and 1", g.Stats["gets_total"], g.MainCache.Items)
+	}
+	if p := g.Peers["http://peer"]; p.Requests != 1 || p.LatencyBuckets["10"] != 1 {
+		t.Errorf("snapshot of the peer = %+v; want 1 request", p)
+	}
+	if _, ok := g.Policy["main"]["admitted"]; !ok {
+		t.Errorf("snapshot of the policy = %v; want the main cache's counters", g.Policy)
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// observer.go reports loads, peer errors, evictions and hotCache
+// promotions to a group's Observer.
+
+package groupcache
+
+import (
+	"time"
+)
+
+// An Observer receives the events of a group, so that they may be
+// logged, alerted on or audited. Its methods are called synchronously,
+// and OnEvict with a cache of the group locked: they must be fast, and
+// must not call the group. An Observer should embed NopObserver, so
+// that it need only implement the events it is interested in.
+type Observer interface {
+	// OnLoad is called when a load of a key missing from the caches
+	// completes, once for concurrent Gets of the key.
+	OnLoad(LoadEvent)
+
+	// OnPeerError is called when a request to a peer fails.
+	OnPeerError(PeerErrorEvent)
+
+	// OnEvict is called when a key leaves a cache, either evicted to
+	// make room or removed because it expired or was removed.
+	OnEvict(EvictEvent)
+
+	// OnHotPromote is called when a key loaded from a peer is
+	// mirrored in the hotCache.
+	OnHotPromote(HotPromoteEvent)
+}
+
+// NopObserver is an Observer that ignores all events.
+type NopObserver struct{}
+
+func (NopObserver) OnLoad(LoadEvent)             {}
+func (NopObserver) OnPeerError(PeerErrorEvent)   {}
+func (NopObserver) OnEvict(EvictEvent)           {}
+func (NopObserver) OnHotPromote(HotPromoteEvent) {}
+
+// LoadSource is where a load found the value of a key.
+type LoadSource int
+
+const (
+	// LoadLocal is the group's Getter, in this process.
+	LoadLocal LoadSource = iota + 1
+	// LoadPeer is the peer that owns the key, or one that took over
+	// from it.
+	LoadPeer
+)
+
+// String returns "local" or "peer".
+func (s LoadSource) String() string {
+	switch s {
+	case LoadLocal:
+		return "local"
+	case LoadPeer:
+		return "peer"
+	}
+	return "unknown"
+}
+
+// A LoadEvent describes a load of a key.
+type LoadEvent struct {
+	Group    string
+	Key      string
+	Source   LoadSource
+	Duration time.Duration // including requests to peers that failed
+	Err      error         // nil, ErrNotFound or the error of the load
+}
+
+// A PeerErrorEvent describes a failed request to a peer.
+type PeerErrorEvent struct {
+	Group string
+	Peer  string // named as in PeerStats
+	Key   string // empty for a request for several keys
+	Err   error
+}
+
+// An EvictEvent describes a key leaving a cache.
+type EvictEvent struct {
+	Group string
+	Key   string
+	Bytes int64 // of the key and its value
+	Cache CacheType
+}
+
+// A HotPromoteEvent describes a key mirrored in the hotCache.
+type HotPromoteEvent struct {
+	Group string
+	Key   string
+	Bytes int64 // of the key and its value
+
+	// QPS is the rate at which the owner of the key reported it is
+	// read, or zero if the owner does not report rates and the key
+	// was mirrored at random.
+	QPS float64
+}
+
+// observeLoad reports a load of key that started at start.
+func (g *Group) observeLoad(key string, source LoadSource, start time.Time, err error) {
+	if g.opts.Observer == nil {
+		return
+	}
+	g.opts.Observer.OnLoad(LoadEvent{
+		Group:    g.name,
+		Key:      key,
+		Source:   source,
+		Duration: time.Since(start),
+		Err:      err,
+	})
+}
+
+// observeEvict returns the function that reports the keys leaving the
+// cache of type which, or nil if the group has no Observer.
+func (g *Group) observeEvict(which CacheType) func(key string, bytes int64) {
+	obs := g.opts.Observer
+	if obs == nil {
+		return nil
+	}
+	return func(key string, bytes int64) {
+		obs.OnEvict(EvictEvent{Group: g.name, Key: key, Bytes: bytes, Cache: which})
+	}
+}
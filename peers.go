@@ -32,6 +32,24 @@ type ProtoGetter interface {
 	Get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error
 }
 
+// ProtoRemover is the interface implemented by peers that support
+// removing a key from their caches.
+type ProtoRemover interface {
+	Remove(ctx context.Context, in *pb.RemoveRequest, out *pb.RemoveResponse) error
+}
+
+// ProtoSetter is the interface implemented by peers that support
+// storing a value directly into their cache.
+type ProtoSetter interface {
+	Set(ctx context.Context, in *pb.SetRequest, out *pb.SetResponse) error
+}
+
+// ProtoMultiGetter is the interface implemented by peers that support
+// fetching several keys in a single request.
+type ProtoMultiGetter interface {
+	GetMulti(ctx context.Context, in *pb.GetMultiRequest, out *pb.GetMultiResponse) error
+}
+
 // PeerPicker is the interface that must be implemented to locate
 // the peer that owns a specific key.
 type PeerPicker interface {
@@ -41,24 +59,107 @@ type PeerPicker interface {
 	PickPeer(key string) (peer ProtoGetter, ok bool)
 }
 
+// FailoverPicker is the interface implemented by a PeerPicker that can
+// pick the peers that take over a key when its owner fails.
+type FailoverPicker interface {
+	// PickPeers returns the peers to try in turn for key, starting
+	// with the peer that PickPeer returns. The list stops before the
+	// current peer: it is empty if the current peer owns the key,
+	// and the key is loaded locally if all the peers fail.
+	// ownerSkipped reports whether the owner of key was left out of
+	// the list, for example because it is down.
+	//
+	// The peers other than the owner are sent failover requests,
+	// which they answer by loading the key themselves.
+	PickPeers(key string) (peers []ProtoGetter, ownerSkipped bool)
+}
+
+// pickPeers returns the peers to try in turn for key, and whether the
+// owner of key was left out of them.
+func pickPeers(peers PeerPicker, key string) ([]ProtoGetter, bool) {
+	if fp, ok := peers.(FailoverPicker); ok {
+		return fp.PickPeers(key)
+	}
+	if peer, ok := peers.PickPeer(key); ok {
+		return []ProtoGetter{peer}, false
+	}
+	return nil, false
+}
+
+// failoverPeers is a PeerPicker that picks the peers that take over
+// from failed, which failed to provide keys.
+type failoverPeers struct {
+	peers  PeerPicker
+	failed ProtoGetter
+}
+
+func (f failoverPeers) PickPeer(key string) (ProtoGetter, bool) {
+	if peers, _ := f.PickPeers(key); len(peers) > 0 {
+		return peers[0], true
+	}
+	return nil, false
+}
+
+// PickPeers returns the peers after failed, or all the peers if failed
+// was left out of them, as its circuit opened. All of them take over
+// from the owner.
+func (f failoverPeers) PickPeers(key string) ([]ProtoGetter, bool) {
+	peers, _ := pickPeers(f.peers, key)
+	for i, peer := range peers {
+		if peer == f.failed {
+			return peers[i+1:], true
+		}
+	}
+	return peers, true
+}
+
+// PeerLister is the interface implemented by a PeerPicker that can
+// enumerate its peers. It is used to broadcast invalidations.
+type PeerLister interface {
+	// ListPeers returns all remote peers, excluding the current
+	// peer.
+	ListPeers() []ProtoGetter
+}
+
+// LoadCounter is the interface implemented by a PeerPicker that
+// balances the loads of the peers, so that it counts the loads of the
+// current process too.
+type LoadCounter interface {
+	// BeginLoad is called when the current process starts loading
+	// a key itself, rather than from a peer. The returned function
+	// is called when the load is done.
+	BeginLoad() (done func())
+}
+
+// beginLoad counts a load by the current process in peers, if they
+// are a LoadCounter, and returns the function that ends it.
+func beginLoad(peers PeerPicker) (done func()) {
+	if f, ok := peers.(failoverPeers); ok {
+		peers = f.peers
+	}
+	if lc, ok := peers.(LoadCounter); ok {
+		return lc.BeginLoad()
+	}
+	return func() {}
+}
+
 // NoPeers is an implementation of PeerPicker that never finds a peer.
 type NoPeers struct{}
 
 func (NoPeers) PickPeer(key string) (peer ProtoGetter, ok bool) { return }
 
-var (
-	portPicker func(groupName string) PeerPicker
-)
-
 // RegisterPeerPicker registers the peer initialization function.
 // It is called once, when the first group is created.
 // Either RegisterPeerPicker or RegisterPerGroupPeerPicker should be
 // called exactly once, but not both.
 func RegisterPeerPicker(fn func() PeerPicker) {
-	if portPicker != nil {
-		panic("RegisterPeerPicker called more than once")
-	}
-	portPicker = func(_ string) PeerPicker { return fn() }
+	DefaultRegistry.RegisterPeerPicker(fn)
+}
+
+// RegisterPeerPicker is like the package-level RegisterPeerPicker,
+// but registers the function for the groups of r.
+func (r *Registry) RegisterPeerPicker(fn func() PeerPicker) {
+	r.RegisterPerGroupPeerPicker(func(_ string) PeerPicker { return fn() })
 }
 
 // RegisterPerGroupPeerPicker registers the peer initialization function,
@@ -67,13 +168,25 @@ func RegisterPeerPicker(fn func() PeerPicker) {
 // Either RegisterPeerPicker or RegisterPerGroupPeerPicker should be
 // called exactly once, but not both.
 func RegisterPerGroupPeerPicker(fn func(groupName string) PeerPicker) {
-	if portPicker != nil {
+	DefaultRegistry.RegisterPerGroupPeerPicker(fn)
+}
+
+// RegisterPerGroupPeerPicker is like the package-level
+// RegisterPerGroupPeerPicker, but registers the function for the
+// groups of r.
+func (r *Registry) RegisterPerGroupPeerPicker(fn func(groupName string) PeerPicker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.portPicker != nil {
 		panic("RegisterPeerPicker called more than once")
 	}
-	portPicker = fn
+	r.portPicker = fn
 }
 
-func getPeers(groupName string) PeerPicker {
+func (r *Registry) getPeers(groupName string) PeerPicker {
+	r.mu.RLock()
+	portPicker := r.portPicker
+	r.mu.RUnlock()
 	if portPicker == nil {
 		return NoPeers{}
 	}
@@ -0,0 +1,158 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// peerstats.go keeps statistics of the requests that groups send to peers.
+
+package groupcache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// PeerStats are the statistics of the Get and GetMulti requests that a
+// group sent to one peer.
+type PeerStats struct {
+	Requests AtomicInt // requests sent
+	Errors   AtomicInt // requests that failed
+	Latency  Histogram // of the durations of the requests
+}
+
+// latencyBuckets are the upper bounds, in seconds, of the buckets of
+// a Histogram.
+var latencyBuckets = [...]float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// A Histogram counts durations in buckets of exponentially increasing
+// bounds, from a millisecond to ten seconds.
+type Histogram struct {
+	counts [len(latencyBuckets) + 1]AtomicInt // the last is unbounded
+	sum    AtomicInt                          // in nanoseconds
+}
+
+// Observe counts d.
+func (h *Histogram) Observe(d time.Duration) {
+	s := d.Seconds()
+	i := sort.SearchFloat64s(latencyBuckets[:], s)
+	h.counts[i].Add(1)
+	h.sum.Add(int64(d))
+}
+
+// Buckets returns the upper bounds of the buckets in seconds and, for
+// each, the number of durations up to that bound, including those of
+// the lower buckets.
+func (h *Histogram) Buckets() (bounds []float64, counts []int64) {
+	bounds = latencyBuckets[:]
+	counts = make([]int64, len(bounds))
+	var n int64
+	for i := range bounds {
+		n += h.counts[i].Get()
+		counts[i] = n
+	}
+	return bounds, counts
+}
+
+// Count returns the number of durations counted.
+func (h *Histogram) Count() int64 {
+	var n int64
+	for i := range h.counts {
+		n += h.counts[i].Get()
+	}
+	return n
+}
+
+// Sum returns the sum of the durations counted.
+func (h *Histogram) Sum() time.Duration {
+	return time.Duration(h.sum.Get())
+}
+
+// PeerStats returns the statistics of the requests that g sent to each
+// peer, keyed by the name of the peer: the String of peers that
+// implement fmt.Stringer, such as the peers of an HTTPPool, which are
+// named by their base URL.
+func (g *Group) PeerStats() map[string]*PeerStats {
+	stats := make(map[string]*PeerStats)
+	g.peerStats.Range(func(name, s interface{}) bool {
+		stats[name.(string)] = s.(*PeerStats)
+		return true
+	})
+	return stats
+}
+
+// maxPeerErrors is the number of recent peer errors a group keeps.
+const maxPeerErrors = 20
+
+// A PeerError records a request to a peer that failed.
+type PeerError struct {
+	Time  time.Time
+	Peer  string
+	Key   string // empty for a request for several keys
+	Error string
+}
+
+// RecentPeerErrors returns the last errors of the requests that g sent
+// to peers, newest first.
+func (g *Group) RecentPeerErrors() []PeerError {
+	g.peerErrMu.Lock()
+	defer g.peerErrMu.Unlock()
+	errs := make([]PeerError, 0, len(g.peerErrs))
+	for i := 1; i <= len(g.peerErrs); i++ {
+		errs = append(errs, g.peerErrs[(g.nPeerErrs-i)%maxPeerErrors])
+	}
+	return errs
+}
+
+// peerName returns the name of peer in PeerStats.
+func peerName(peer interface{}) string {
+	if s, ok := peer.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T(%p)", peer, peer)
+}
+
+// observePeer records a request to peer for key that started at start
+// and failed if err is not nil. A request that failed because ctx is
+// done, such as the loser of a hedge, isn't an error of the peer.
+func (g *Group) observePeer(ctx context.Context, peer interface{}, key string, start time.Time, err error) {
+	name := peerName(peer)
+	si, ok := g.peerStats.Load(name)
+	if !ok {
+		si, _ = g.peerStats.LoadOrStore(name, new(PeerStats))
+	}
+	s := si.(*PeerStats)
+	s.Requests.Add(1)
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+	s.Latency.Observe(time.Since(start))
+	if err == nil {
+		return
+	}
+	s.Errors.Add(1)
+	if obs := g.opts.Observer; obs != nil {
+		obs.OnPeerError(PeerErrorEvent{Group: g.name, Peer: name, Key: key, Err: err})
+	}
+	pe := PeerError{Time: start, Peer: name, Key: key, Error: err.Error()}
+	g.peerErrMu.Lock()
+	defer g.peerErrMu.Unlock()
+	if len(g.peerErrs) < maxPeerErrors {
+		g.peerErrs = append(g.peerErrs, pe)
+	} else {
+		g.peerErrs[g.nPeerErrs%maxPeerErrors] = pe
+	}
+	g.nPeerErrs++
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// policy.go defines the eviction policies of a Group's caches.
+
+package groupcache
+
+import (
+	"github.com/golang/groupcache/lfu"
+	"github.com/golang/groupcache/lru"
+	"github.com/golang/groupcache/tinylfu"
+)
+
+// An EvictionPolicy holds the entries of one of a Group's caches and
+// chooses which of them to evict when the Group exceeds its size.
+// Implementations need not be safe for concurrent access.
+type EvictionPolicy interface {
+	// Add adds or replaces the value of key.
+	Add(key string, value interface{})
+
+	// Get returns the value of key and records a use of it.
+	Get(key string) (value interface{}, ok bool)
+
+	// Peek returns the value of key without recording a use of it.
+	Peek(key string) (value interface{}, ok bool)
+
+	// Remove removes key, calling the policy's onEvicted function.
+	Remove(key string)
+
+	// Evict removes one entry chosen by the policy, calling the
+	// policy's onEvicted function.
+	Evict()
+
+	// Len returns the number of entries.
+	Len() int
+
+	// Stats returns counters specific to the policy, keyed by name.
+	// It may return nil.
+	Stats() map[string]int64
+}
+
+// A PolicyFunc creates an EvictionPolicy that calls onEvicted with
+// each entry it removes.
+type PolicyFunc func(onEvicted func(key string, value interface{})) EvictionPolicy
+
+// NewLRUPolicy returns a policy that evicts the least recently used
+// entry. It is the default policy.
+func NewLRUPolicy(onEvicted func(key string, value interface{})) EvictionPolicy {
+	return lruPolicy{&lru.Cache{
+		OnEvicted: func(key lru.Key, value interface{}) {
+			onEvicted(key.(string), value)
+		},
+	}}
+}
+
+type lruPolicy struct {
+	c *lru.Cache
+}
+
+func (p lruPolicy) Add(key string, value interface{})            { p.c.Add(key, value) }
+func (p lruPolicy) Get(key string) (value interface{}, ok bool)  { return p.c.Get(key) }
+func (p lruPolicy) Peek(key string) (value interface{}, ok bool) { return p.c.Peek(key) }
+func (p lruPolicy) Remove(key string)                            { p.c.Remove(key) }
+func (p lruPolicy) Evict()                                       { p.c.RemoveOldest() }
+func (p lruPolicy) Len() int                                     { return p.c.Len() }
+func (p lruPolicy) Stats() map[string]int64                      { return nil }
+
+// NewLFUPolicy returns a policy that evicts the least frequently used
+// entry, and the least recently used one among equally used entries.
+func NewLFUPolicy(onEvicted func(key string, value interface{})) EvictionPolicy {
+	return lfuPolicy{&lfu.Cache{
+		OnEvicted: func(key lfu.Key, value interface{}) {
+			onEvicted(key.(string), value)
+		},
+	}}
+}
+
+type lfuPolicy struct {
+	c *lfu.Cache
+}
+
+func (p lfuPolicy) Add(key string, value interface{})            { p.c.Add(key, value) }
+func (p lfuPolicy) Get(key string) (value interface{}, ok bool)  { return p.c.Get(key) }
+func (p lfuPolicy) Peek(key string) (value interface{}, ok bool) { return p.c.Peek(key) }
+func (p lfuPolicy) Remove(key string)                            { p.c.Remove(key) }
+func (p lfuPolicy) Evict()                                       { p.c.RemoveLeastFrequent() }
+func (p lfuPolicy) Len() int                                     { return p.c.Len() }
+func (p lfuPolicy) Stats() map[string]int64                      { return nil }
+
+// NewTinyLFUPolicy returns a W-TinyLFU policy, which only lets a new
+// entry displace an older one if it is estimated to be used more
+// often. It suits workloads that scan many keys used only once.
+//
+// Its Stats are "admitted" and "rejected", the numbers of new entries
+// that did and did not displace an older one, and "resets", the
+// number of times the usage estimates were aged.
+func NewTinyLFUPolicy(onEvicted func(key string, value interface{})) EvictionPolicy {
+	return tinyLFUPolicy{&tinylfu.Cache{OnEvicted: onEvicted}}
+}
+
+type tinyLFUPolicy struct {
+	*tinylfu.Cache
+}
+
+func (p tinyLFUPolicy) Stats() map[string]int64 {
+	s := p.Cache.Stats()
+	return map[string]int64{
+		"admitted": s.Admitted,
+		"rejected": s.Rejected,
+		"resets":   s.Resets,
+	}
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// server.go answers the requests that peers send each other.
+
+package groupcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/golang/protobuf/proto"
+)
+
+// ErrNoGroup is returned by a Server for requests naming a group that
+// is not registered or is closed.
+var ErrNoGroup = errors.New("groupcache: no such group")
+
+// A Server implements the GroupCache service of groupcachepb for the
+// groups of a Registry. Peer transports use it to answer the requests
+// of other peers; see HTTPPool and the grpcpool package.
+type Server struct {
+	// Registry holds the groups served.
+	// If nil, it defaults to DefaultRegistry.
+	Registry *Registry
+
+	// LoadLocally specifies that keys missing from the caches are
+	// loaded by this process, rather than by the peer that the
+	// group's PeerPicker picks. It must be set when peers may send
+	// keys to a process other than their owner, so that requests
+	// are not forwarded again.
+	LoadLocally bool
+}
+
+// peers returns the PeerPicker through which g loads keys. Keys of
+// failover requests are loaded locally, since the peer that sent them
+// could not reach the owner.
+func (s *Server) peers(g *Group, failover bool) PeerPicker {
+	if s.LoadLocally || failover {
+		return NoPeers{}
+	}
+	g.peersOnce.Do(g.initPeers)
+	return g.peers
+}
+
+// begin returns the named group, after calling its begin method. The
+// caller must call its done method when finished.
+func (s *Server) begin(name string) (*Group, error) {
+	r := s.Registry
+	if r == nil {
+		r = DefaultRegistry
+	}
+	g := r.GetGroup(name)
+	if g == nil || !g.begin() {
+		return nil, fmt.Errorf("%w: %s", ErrNoGroup, name)
+	}
+	return g, nil
+}
+
+// Get loads the value of a key. If the key has no value, it sets
+// out.NotFound rather than returning ErrNotFound.
+func (s *Server) Get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	value, qps, err := s.get(ctx, in)
+	return setGetResult(out, value, qps, err)
+}
+
+// get loads the value of a key, and returns it with the request rate
+// of the key.
+func (s *Server) get(ctx context.Context, in *pb.GetRequest) (value ByteView, qps float64, err error) {
+	g, err := s.begin(in.GetGroup())
+	if err != nil {
+		return ByteView{}, 0, err
+	}
+	defer g.done()
+	g.Stats.ServerRequests.Add(1)
+	err = g.get(ctx, in.GetKey(), &codedSink{byteViewSink{dst: &value}}, s.peers(g, in.GetFailover()))
+	if err == nil {
+		value, err = value.forPeer(in.GetAcceptCodec())
+	}
+	if err != nil {
+		return ByteView{}, 0, err
+	}
+	return value, g.minuteQPS(in.GetKey()), nil
+}
+
+// Remove removes a key from the caches of this process only.
+func (s *Server) Remove(ctx context.Context, in *pb.RemoveRequest, out *pb.RemoveResponse) error {
+	g, err := s.begin(in.GetGroup())
+	if err != nil {
+		return err
+	}
+	defer g.done()
+	g.localRemove(in.GetKey())
+	return nil
+}
+
+// Set stores a value in the mainCache of this process.
+func (s *Server) Set(ctx context.Context, in *pb.SetRequest, out *pb.SetResponse) error {
+	g, err := s.begin(in.GetGroup())
+	if err != nil {
+		return err
+	}
+	defer g.done()
+	value := ByteView{b: in.GetValue()}
+	if e := in.GetExpire(); e != 0 {
+		value.e = time.Unix(0, e)
+	}
+	g.localSet(ctx, in.GetKey(), value)
+	return nil
+}
+
+// GetMulti loads the values of several keys. Errors loading a key,
+// including ErrNotFound, are reported in its response.
+func (s *Server) GetMulti(ctx context.Context, in *pb.GetMultiRequest, out *pb.GetMultiResponse) error {
+	g, err := s.begin(in.GetGroup())
+	if err != nil {
+		return err
+	}
+	defer g.done()
+	g.Stats.ServerRequests.Add(int64(len(in.Key)))
+	values := make(map[string]*ByteView, len(in.Key))
+	sinks := make(map[string]Sink, len(in.Key))
+	for _, key := range in.Key {
+		if _, dup := sinks[key]; !dup {
+			values[key] = new(ByteView)
+			sinks[key] = &codedSink{byteViewSink{dst: values[key]}}
+		}
+	}
+	errs := g.getMulti(ctx, sinks, s.peers(g, in.GetFailover()))
+	out.Response = make([]*pb.GetResponse, len(in.Key))
+	for i, key := range in.Key {
+		res := &pb.GetResponse{}
+		if err := errs[key]; errors.Is(err, ErrNotFound) {
+			res.NotFound = proto.Bool(true)
+		} else if err != nil {
+			res.Error = proto.String(err.Error())
+		} else if value, err := values[key].forPeer(in.GetAcceptCodec()); err != nil {
+			res.Error = proto.String(err.Error())
+		} else {
+			setGetResponse(res, value)
+			res.MinuteQps = proto.Float64(g.minuteQPS(key))
+		}
+		out.Response[i] = res
+	}
+	return nil
+}
+
+// setGetResult sets res to the result of loading a key: its value and
+// request rate or, if err is ErrNotFound, NotFound. It returns err
+// for other errors.
+func setGetResult(res *pb.GetResponse, value ByteView, qps float64, err error) error {
+	if errors.Is(err, ErrNotFound) {
+		res.NotFound = proto.Bool(true)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	setGetResponse(res, value)
+	res.MinuteQps = proto.Float64(qps)
+	return nil
+}
+
+// setGetResponse sets the value, expiry and codec of res to those of
+// value.
+func setGetResponse(res *pb.GetResponse, value ByteView) {
+	res.Value = value.ByteSlice()
+	if e := value.Expire(); !e.IsZero() {
+		res.Expire = proto.Int64(e.UnixNano())
+	}
+	if value.codec != nil {
+		res.Codec = proto.String(value.codec.Name())
+	}
+}
@@ -62,3 +62,51 @@ func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, err
 
 	return c.val, c.err
 }
+
+// A Call is a call started by Begin.
+type Call struct {
+	g   *Group
+	key string
+	c   *call
+}
+
+// Begin starts a call for key, as Do does, but leaves the caller to
+// run it: the caller must end the call with Done, and duplicates wait
+// for it meanwhile. If a call for key is already in flight, Begin
+// returns nil and false.
+func (g *Group) Begin(key string) (*Call, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if _, ok := g.m[key]; ok {
+		return nil, false
+	}
+	c := new(call)
+	c.wg.Add(1)
+	g.m[key] = c
+	return &Call{g: g, key: key, c: c}, true
+}
+
+// Done ends the call with the given results, which the duplicates of
+// the call receive.
+func (c *Call) Done(val interface{}, err error) {
+	c.c.val, c.c.err = val, err
+	c.c.wg.Done()
+
+	c.g.mu.Lock()
+	delete(c.g.m, c.key)
+	c.g.mu.Unlock()
+}
+
+// Keys returns the keys of the calls in flight, in no particular order.
+func (g *Group) Keys() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	keys := make([]string, 0, len(g.m))
+	for key := range g.m {
+		keys = append(keys, key)
+	}
+	return keys
+}
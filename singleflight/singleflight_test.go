@@ -83,3 +83,49 @@ func TestDoDupSuppress(t *testing.T) {
 		t.Errorf("number of calls = %d; want 1", got)
 	}
 }
+
+func TestKeys(t *testing.T) {
+	var g Group
+	started, release := make(chan bool), make(chan bool)
+	go g.Do("key", func() (interface{}, error) {
+		started <- true
+		<-release
+		return nil, nil
+	})
+	<-started
+	if keys := g.Keys(); len(keys) != 1 || keys[0] != "key" {
+		t.Errorf("Keys during Do = %q; want [key]", keys)
+	}
+	release <- true
+	for i := 0; len(g.Keys()) != 0; i++ {
+		if i == 100 {
+			t.Fatalf("Keys after Do = %q; want none", g.Keys())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBegin(t *testing.T) {
+	var g Group
+	c, ok := g.Begin("key")
+	if !ok {
+		t.Fatal("Begin = false; want a new call")
+	}
+	if _, ok := g.Begin("key"); ok {
+		t.Error("second Begin = true; want the call in flight")
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		c.Done("bar", nil)
+	}()
+	v, err := g.Do("key", func() (interface{}, error) {
+		t.Error("Do ran its function during the call")
+		return nil, nil
+	})
+	if v != "bar" || err != nil {
+		t.Errorf("Do = %v, %v; want bar", v, err)
+	}
+	if _, ok := g.Begin("key"); !ok {
+		t.Error("Begin after Done = false; want a new call")
+	}
+}
@@ -18,6 +18,8 @@ package groupcache
 
 import (
 	"errors"
+	"io"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 )
@@ -38,6 +40,12 @@ type Sink interface {
 	// The caller retains ownership of m.
 	SetProto(m proto.Message) error
 
+	// SetExpire sets the time at which the value expires and
+	// is dropped from the caches of all peers. It may be called
+	// before or after the Set method above. The zero Time, which
+	// is the default, means the value never expires.
+	SetExpire(e time.Time)
+
 	// view returns a frozen view of the bytes for caching.
 	view() (ByteView, error)
 }
@@ -49,6 +57,12 @@ func cloneBytes(b []byte) []byte {
 }
 
 func setSinkView(s Sink, v ByteView) error {
+	if _, ok := s.(*codedSink); !ok {
+		var err error
+		if v, err = v.decode(); err != nil {
+			return err
+		}
+	}
 	// A viewSetter is a Sink that can also receive its value from
 	// a ByteView. This is a fast path to minimize copies when the
 	// item was already cached locally in memory (where it's
@@ -59,6 +73,7 @@ func setSinkView(s Sink, v ByteView) error {
 	if vs, ok := s.(viewSetter); ok {
 		return vs.setView(v)
 	}
+	s.SetExpire(v.e)
 	if v.b != nil {
 		return s.SetBytes(v.b)
 	}
@@ -73,12 +88,19 @@ func StringSink(sp *string) Sink {
 type stringSink struct {
 	sp *string
 	v  ByteView
+	e  time.Time
 	// TODO(bradfitz): track whether any Sets were called.
 }
 
 func (s *stringSink) view() (ByteView, error) {
 	// TODO(bradfitz): return an error if no Set was called
-	return s.v, nil
+	v := s.v
+	v.e = s.e
+	return v, nil
+}
+
+func (s *stringSink) SetExpire(e time.Time) {
+	s.e = e
 }
 
 func (s *stringSink) SetString(v string) error {
@@ -112,6 +134,7 @@ func ByteViewSink(dst *ByteView) Sink {
 
 type byteViewSink struct {
 	dst *ByteView
+	e   time.Time
 
 	// if this code ever ends up tracking that at least one set*
 	// method was called, don't make it an error to call set
@@ -125,9 +148,15 @@ type byteViewSink struct {
 
 func (s *byteViewSink) setView(v ByteView) error {
 	*s.dst = v
+	s.e = v.e
 	return nil
 }
 
+func (s *byteViewSink) SetExpire(e time.Time) {
+	s.e = e
+	s.dst.e = e
+}
+
 func (s *byteViewSink) view() (ByteView, error) {
 	return *s.dst, nil
 }
@@ -137,20 +166,26 @@ func (s *byteViewSink) SetProto(m proto.Message) error {
 	if err != nil {
 		return err
 	}
-	*s.dst = ByteView{b: b}
+	*s.dst = ByteView{b: b, e: s.e}
 	return nil
 }
 
 func (s *byteViewSink) SetBytes(b []byte) error {
-	*s.dst = ByteView{b: cloneBytes(b)}
+	*s.dst = ByteView{b: cloneBytes(b), e: s.e}
 	return nil
 }
 
 func (s *byteViewSink) SetString(v string) error {
-	*s.dst = ByteView{s: v}
+	*s.dst = ByteView{s: v, e: s.e}
 	return nil
 }
 
+// A codedSink is a ByteViewSink that receives cached values as they
+// are, even if encoded by the group's Codec, for sending to peers.
+type codedSink struct {
+	byteViewSink
+}
+
 // ProtoSink returns a sink that unmarshals binary proto values into m.
 func ProtoSink(m proto.Message) Sink {
 	return &protoSink{
@@ -163,10 +198,17 @@ type protoSink struct {
 	typ string
 
 	v ByteView // encoded
+	e time.Time
 }
 
 func (s *protoSink) view() (ByteView, error) {
-	return s.v, nil
+	v := s.v
+	v.e = s.e
+	return v, nil
+}
+
+func (s *protoSink) SetExpire(e time.Time) {
+	s.e = e
 }
 
 func (s *protoSink) SetBytes(b []byte) error {
@@ -218,10 +260,17 @@ func AllocatingByteSliceSink(dst *[]byte) Sink {
 type allocBytesSink struct {
 	dst *[]byte
 	v   ByteView
+	e   time.Time
 }
 
 func (s *allocBytesSink) view() (ByteView, error) {
-	return s.v, nil
+	v := s.v
+	v.e = s.e
+	return v, nil
+}
+
+func (s *allocBytesSink) SetExpire(e time.Time) {
+	s.e = e
 }
 
 func (s *allocBytesSink) setView(v ByteView) error {
@@ -231,6 +280,7 @@ func (s *allocBytesSink) setView(v ByteView) error {
 		*s.dst = []byte(v.s)
 	}
 	s.v = v
+	s.e = v.e
 	return nil
 }
 
@@ -277,10 +327,17 @@ func TruncatingByteSliceSink(dst *[]byte) Sink {
 type truncBytesSink struct {
 	dst *[]byte
 	v   ByteView
+	e   time.Time
 }
 
 func (s *truncBytesSink) view() (ByteView, error) {
-	return s.v, nil
+	v := s.v
+	v.e = s.e
+	return v, nil
+}
+
+func (s *truncBytesSink) SetExpire(e time.Time) {
+	s.e = e
 }
 
 func (s *truncBytesSink) SetProto(m proto.Message) error {
@@ -320,3 +377,61 @@ func (s *truncBytesSink) SetString(v string) error {
 	s.v.s = v
 	return nil
 }
+
+// WriterSink returns a Sink that writes the received value to w. A
+// value from the caches is written straight from them, without a copy,
+// which suits large values passed on to, for example, an
+// http.ResponseWriter. If writing fails, the Get call returns the
+// error.
+func WriterSink(w io.Writer) Sink {
+	return &writerSink{w: w}
+}
+
+type writerSink struct {
+	w io.Writer
+	v ByteView
+	e time.Time
+}
+
+func (s *writerSink) view() (ByteView, error) {
+	v := s.v
+	v.e = s.e
+	return v, nil
+}
+
+func (s *writerSink) SetExpire(e time.Time) {
+	s.e = e
+}
+
+func (s *writerSink) setView(v ByteView) error {
+	s.v = v
+	s.e = v.e
+	return s.write()
+}
+
+func (s *writerSink) SetProto(m proto.Message) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	s.v = ByteView{b: b}
+	return s.write()
+}
+
+func (s *writerSink) SetBytes(b []byte) error {
+	s.v = ByteView{b: cloneBytes(b)}
+	return s.write()
+}
+
+func (s *writerSink) SetString(v string) error {
+	s.v = ByteView{s: v}
+	return s.write()
+}
+
+func (s *writerSink) write() error {
+	if s.w == nil {
+		return errors.New("nil WriterSink io.Writer")
+	}
+	_, err := s.v.WriteTo(s.w)
+	return err
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// split.go defines how a Group divides its memory between its caches.
+
+package groupcache
+
+import "sync"
+
+// A CacheSplit decides how a Group divides its cacheBytes between its
+// mainCache and its hotCache.
+type CacheSplit interface {
+	// Victim returns the cache from which the group must evict an
+	// entry, given the group's cacheBytes and the stats of its two
+	// caches, or 0 if both caches may keep all their entries.
+	Victim(cacheBytes int64, main, hot CacheStats) CacheType
+}
+
+// defaultSplit lets the hotCache hold up to an eighth of the size of
+// the mainCache.
+type defaultSplit struct{}
+
+func (defaultSplit) Victim(cacheBytes int64, main, hot CacheStats) CacheType {
+	if main.Bytes+hot.Bytes <= cacheBytes {
+		return 0
+	}
+	// TODO(bradfitz): this is good-enough-for-now logic.
+	// It should be something based on measurements and/or
+	// respecting the costs of different resources.
+	if hot.Bytes > main.Bytes/8 {
+		return HotCache
+	}
+	return MainCache
+}
+
+// SplitRatio returns a CacheSplit that lets the hotCache use up to the
+// fraction hot of the group's cacheBytes. The mainCache may use the
+// rest, and whatever the hotCache leaves unused.
+// With a hot of zero, the group keeps no hotCache.
+func SplitRatio(hot float64) CacheSplit {
+	return ratioSplit(hot)
+}
+
+type ratioSplit float64
+
+func (r ratioSplit) Victim(cacheBytes int64, main, hot CacheStats) CacheType {
+	if hot.Bytes > int64(float64(r)*float64(cacheBytes)) {
+		return HotCache
+	}
+	if main.Bytes+hot.Bytes > cacheBytes {
+		return MainCache
+	}
+	return 0
+}
+
+// SplitBytes returns a CacheSplit that gives fixed budgets to the
+// mainCache and to the hotCache. The group's cacheBytes still bounds
+// their sum: when it is exceeded, the mainCache gives up an entry.
+func SplitBytes(mainBytes, hotBytes int64) CacheSplit {
+	return bytesSplit{mainBytes, hotBytes}
+}
+
+type bytesSplit struct {
+	main, hot int64
+}
+
+func (b bytesSplit) Victim(cacheBytes int64, main, hot CacheStats) CacheType {
+	switch {
+	case hot.Bytes > b.hot:
+		return HotCache
+	case main.Bytes > b.main, main.Bytes+hot.Bytes > cacheBytes:
+		return MainCache
+	}
+	return 0
+}
+
+// AdaptiveSplit returns a CacheSplit that shifts memory toward the
+// cache with the higher marginal hit rate. It behaves like SplitRatio,
+// starting with the default share of the hotCache, and periodically
+// grows or shrinks that share by comparing the hits per byte that
+// each cache served since the last adjustment.
+//
+// The returned CacheSplit keeps state about the caches of one group
+// and must not be shared between groups.
+func AdaptiveSplit() CacheSplit {
+	return &adaptiveSplit{hot: 1.0 / 9}
+}
+
+const (
+	adaptiveInterval = 1000 // gets between adjustments
+	adaptiveStep     = 0.05 // change of the hotCache's share
+)
+
+type adaptiveSplit struct {
+	mu       sync.Mutex
+	hot      float64 // share of the hotCache
+	lastMain CacheStats
+	lastHot  CacheStats
+}
+
+func (a *adaptiveSplit) Victim(cacheBytes int64, main, hot CacheStats) CacheType {
+	a.mu.Lock()
+	if main.Gets+hot.Gets-a.lastMain.Gets-a.lastHot.Gets >= adaptiveInterval {
+		a.adjust(main, hot)
+	}
+	r := ratioSplit(a.hot)
+	a.mu.Unlock()
+	return r.Victim(cacheBytes, main, hot)
+}
+
+// adjust moves the hotCache's share toward the cache that served more
+// hits per byte since the last adjustment. Neither cache's share drops
+// below one step, so that each keeps a measurable hit rate.
+func (a *adaptiveSplit) adjust(main, hot CacheStats) {
+	mainRate := hitsPerByte(main.Hits-a.lastMain.Hits, main.Bytes)
+	hotRate := hitsPerByte(hot.Hits-a.lastHot.Hits, hot.Bytes)
+	a.lastMain, a.lastHot = main, hot
+	switch {
+	case hotRate > mainRate && a.hot+adaptiveStep <= 1-adaptiveStep:
+		a.hot += adaptiveStep
+	case hotRate < mainRate && a.hot-adaptiveStep >= adaptiveStep:
+		a.hot -= adaptiveStep
+	}
+}
+
+func hitsPerByte(hits, bytes int64) float64 {
+	if bytes == 0 {
+		return 0
+	}
+	return float64(hits) / float64(bytes)
+}
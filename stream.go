@@ -0,0 +1,116 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// stream.go streams large values between HTTPPool peers.
+
+package groupcache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	pb "github.com/golang/groupcache/groupcachepb"
+)
+
+const defaultStreamThreshold = 1 << 20
+
+// streamContentType is the content type of a value streamed as the
+// raw body of a response. The fields of its GetResponse other than
+// the value are carried by the headers below.
+const streamContentType = "application/octet-stream"
+
+const (
+	expireHeader    = "X-Groupcache-Expire"     // GetResponse.Expire
+	minuteQPSHeader = "X-Groupcache-Minute-Qps" // GetResponse.MinuteQps
+	codecHeader     = "X-Groupcache-Codec"      // GetResponse.Codec
+
+	// acceptCodecHeader carries GetRequest.AcceptCodec, as a
+	// comma-separated list, since GET requests have no body.
+	acceptCodecHeader = "X-Groupcache-Accept-Codec"
+	failoverHeader    = "X-Groupcache-Failover" // GetRequest.Failover
+)
+
+// streams reports whether value is streamed in response to r.
+func (p *HTTPPool) streams(r *http.Request, value ByteView) bool {
+	return p.opts.StreamThreshold > 0 && value.Len() >= p.opts.StreamThreshold &&
+		strings.Contains(r.Header.Get("Accept"), streamContentType)
+}
+
+// writeStream writes value, with its request rate, as the body of the
+// response, without copying it.
+func writeStream(w http.ResponseWriter, value ByteView, qps float64) {
+	h := w.Header()
+	h.Set("Content-Type", streamContentType)
+	h.Set("Content-Length", strconv.Itoa(value.Len()))
+	if e := value.Expire(); !e.IsZero() {
+		h.Set(expireHeader, strconv.FormatInt(e.UnixNano(), 10))
+	}
+	h.Set(minuteQPSHeader, strconv.FormatFloat(qps, 'g', -1, 64))
+	if value.codec != nil {
+		h.Set(codecHeader, value.codec.Name())
+	}
+	value.WriteTo(w)
+}
+
+// maxStreamPrealloc bounds the slice that readStream allocates for a
+// value before reading it, whatever the Content-Length claims.
+const maxStreamPrealloc = 8 << 20
+
+// readStream reads a value streamed by writeStream into out. The value
+// is read straight into a slice of its size when the response has a
+// Content-Length of up to maxStreamPrealloc. A larger value grows its
+// slice as it arrives.
+func readStream(res *http.Response, out *pb.GetResponse) error {
+	var value []byte
+	var err error
+	switch {
+	case res.ContentLength > maxStreamPrealloc:
+		value, err = io.ReadAll(io.LimitReader(res.Body, res.ContentLength))
+		if err == nil && int64(len(value)) < res.ContentLength {
+			err = io.ErrUnexpectedEOF
+		}
+	case res.ContentLength >= 0:
+		value = make([]byte, res.ContentLength)
+		_, err = io.ReadFull(res.Body, value)
+	default:
+		value, err = io.ReadAll(res.Body)
+	}
+	if err != nil {
+		return fmt.Errorf("reading response body: %v", err)
+	}
+	out.Value = value
+	if s := res.Header.Get(expireHeader); s != "" {
+		e, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("decoding %s header: %v", expireHeader, err)
+		}
+		out.Expire = &e
+	}
+	if s := res.Header.Get(minuteQPSHeader); s != "" {
+		qps, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("decoding %s header: %v", minuteQPSHeader, err)
+		}
+		out.MinuteQps = &qps
+	}
+	if s := res.Header.Get(codecHeader); s != "" {
+		out.Codec = &s
+	}
+	return nil
+}
@@ -0,0 +1,352 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tinylfu implements a W-TinyLFU cache.
+//
+// New entries enter a small LRU window. When an entry must be evicted
+// and the window holds more than its share of the entries, the
+// window's least recently used entry competes with the victim of the
+// main cache, a segmented LRU, and the one estimated to be used less
+// often is evicted. Usage is estimated by a count-min sketch of recent
+// accesses, which makes the cache resistant to scans of keys that are
+// used only once.
+package tinylfu
+
+import "container/list"
+
+// Cache is a W-TinyLFU cache. It is not safe for concurrent access.
+type Cache struct {
+	// MaxEntries is the maximum number of cache entries before
+	// an item is evicted. Zero means no limit.
+	MaxEntries int
+
+	// OnEvicted optionally specifies a callback function to be
+	// executed when an entry is purged from the cache.
+	OnEvicted func(key string, value interface{})
+
+	window    *list.List // new entries
+	probation *list.List // main entries used once since admission
+	protected *list.List // main entries used again
+	cache     map[string]*list.Element
+	sketch    sketch
+
+	admitted, rejected int64
+}
+
+// Stats are counters of the cache's admission decisions.
+type Stats struct {
+	Admitted int64 // window entries admitted to the main cache
+	Rejected int64 // window entries evicted in favor of a main entry
+	Resets   int64 // times the usage estimates were halved
+}
+
+type segment int
+
+const (
+	window segment = iota
+	probation
+	protected
+)
+
+type entry struct {
+	key   string
+	value interface{}
+	seg   segment
+}
+
+// New creates a new Cache.
+// If maxEntries is zero, the cache has no limit and it's assumed
+// that eviction is done by the caller.
+func New(maxEntries int) *Cache {
+	c := &Cache{MaxEntries: maxEntries}
+	c.init()
+	return c
+}
+
+func (c *Cache) init() {
+	c.window = list.New()
+	c.probation = list.New()
+	c.protected = list.New()
+	c.cache = make(map[string]*list.Element)
+}
+
+// Add adds a value to the cache.
+func (c *Cache) Add(key string, value interface{}) {
+	if c.cache == nil {
+		c.init()
+	}
+	c.sketch.add(key)
+	if ee, ok := c.cache[key]; ok {
+		ee.Value.(*entry).value = value
+		c.touch(ee)
+		return
+	}
+	c.cache[key] = c.window.PushFront(&entry{key, value, window})
+	c.sketch.grow(len(c.cache))
+	if c.MaxEntries != 0 && len(c.cache) > c.MaxEntries {
+		c.Evict()
+	}
+}
+
+// Get looks up a key's value from the cache.
+func (c *Cache) Get(key string) (value interface{}, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	c.sketch.add(key)
+	if ele, hit := c.cache[key]; hit {
+		c.touch(ele)
+		return ele.Value.(*entry).value, true
+	}
+	return
+}
+
+// Peek looks up a key's value from the cache, without recording a use
+// of it.
+func (c *Cache) Peek(key string) (value interface{}, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if ele, hit := c.cache[key]; hit {
+		return ele.Value.(*entry).value, true
+	}
+	return
+}
+
+// touch records a use of the entry in e.
+func (c *Cache) touch(e *list.Element) {
+	kv := e.Value.(*entry)
+	switch kv.seg {
+	case window:
+		c.window.MoveToFront(e)
+	case probation:
+		c.probation.Remove(e)
+		kv.seg = protected
+		c.cache[kv.key] = c.protected.PushFront(kv)
+		// Keep the protected segment at 80% of the main cache.
+		main := c.probation.Len() + c.protected.Len()
+		for c.protected.Len() > main*8/10 {
+			c.demote(c.protected.Back())
+		}
+	case protected:
+		c.protected.MoveToFront(e)
+	}
+}
+
+// demote moves the protected entry in e to the probation segment.
+func (c *Cache) demote(e *list.Element) {
+	kv := e.Value.(*entry)
+	c.protected.Remove(e)
+	kv.seg = probation
+	c.cache[kv.key] = c.probation.PushFront(kv)
+}
+
+// admit moves the window entry in e to the probation segment.
+func (c *Cache) admit(e *list.Element) {
+	kv := e.Value.(*entry)
+	c.window.Remove(e)
+	kv.seg = probation
+	c.cache[kv.key] = c.probation.PushFront(kv)
+}
+
+// windowMax returns the number of entries the window may hold, 1% of
+// the cache.
+func (c *Cache) windowMax() int {
+	if n := len(c.cache) / 100; n > 1 {
+		return n
+	}
+	return 1
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) {
+	if c.cache == nil {
+		return
+	}
+	if ele, hit := c.cache[key]; hit {
+		c.removeElement(ele)
+	}
+}
+
+// Evict removes one item from the cache, as chosen by the admission
+// policy.
+func (c *Cache) Evict() {
+	if c.cache == nil || len(c.cache) == 0 {
+		return
+	}
+	if c.probation.Len()+c.protected.Len() == 0 {
+		// Nothing was ever admitted: fill the main cache
+		// with the window's overflow without a contest.
+		for c.window.Len() > c.windowMax() {
+			c.admit(c.window.Back())
+		}
+	}
+	victim := c.probation.Back()
+	if victim == nil {
+		victim = c.protected.Back()
+	}
+	if victim == nil {
+		c.removeElement(c.window.Back())
+		return
+	}
+	if c.window.Len() < c.windowMax() {
+		c.removeElement(victim)
+		return
+	}
+	candidate := c.window.Back()
+	if c.sketch.estimate(candidate.Value.(*entry).key) > c.sketch.estimate(victim.Value.(*entry).key) {
+		c.admitted++
+		c.admit(candidate)
+		c.removeElement(victim)
+	} else {
+		c.rejected++
+		c.removeElement(candidate)
+	}
+}
+
+func (c *Cache) removeElement(e *list.Element) {
+	kv := e.Value.(*entry)
+	switch kv.seg {
+	case window:
+		c.window.Remove(e)
+	case probation:
+		c.probation.Remove(e)
+	case protected:
+		c.protected.Remove(e)
+	}
+	delete(c.cache, kv.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// Len returns the number of items in the cache.
+func (c *Cache) Len() int {
+	if c.cache == nil {
+		return 0
+	}
+	return len(c.cache)
+}
+
+// Stats returns the cache's admission counters.
+func (c *Cache) Stats() Stats {
+	return Stats{
+		Admitted: c.admitted,
+		Rejected: c.rejected,
+		Resets:   c.sketch.resets,
+	}
+}
+
+// Clear purges all stored items from the cache.
+func (c *Cache) Clear() {
+	if c.OnEvicted != nil {
+		for _, e := range c.cache {
+			kv := e.Value.(*entry)
+			c.OnEvicted(kv.key, kv.value)
+		}
+	}
+	c.window = nil
+	c.probation = nil
+	c.protected = nil
+	c.cache = nil
+}
+
+// sketch is a count-min sketch of 4-bit counters that estimates how
+// often keys were used recently. The counters are halved periodically
+// so that the estimates favor recent use.
+type sketch struct {
+	rows   [4][]uint8
+	adds   int // since the last reset
+	resets int64
+}
+
+const (
+	minSketchWidth = 16
+	maxCount       = 15
+	resetFactor    = 10 // reset after adds reach resetFactor times the width
+)
+
+// grow makes the sketch wide enough to tell n keys apart. The
+// current estimates carry over: a key's counter in the wider row
+// starts from its counter in the old one.
+func (s *sketch) grow(n int) {
+	w := minSketchWidth
+	for w < n {
+		w *= 2
+	}
+	old := len(s.rows[0])
+	if w <= old {
+		return
+	}
+	for i, row := range s.rows {
+		s.rows[i] = make([]uint8, w)
+		if old > 0 {
+			for j := range s.rows[i] {
+				s.rows[i][j] = row[j&(old-1)]
+			}
+		}
+	}
+}
+
+// indexes returns the counter index of key in each row.
+func (s *sketch) indexes(key string) (idx [4]uint32) {
+	// FNV-1a, split into two hashes for double hashing.
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	h1, h2 := uint32(h), uint32(h>>32)|1
+	mask := uint32(len(s.rows[0]) - 1)
+	for i := range idx {
+		idx[i] = (h1 + uint32(i)*h2) & mask
+	}
+	return idx
+}
+
+func (s *sketch) add(key string) {
+	if s.rows[0] == nil {
+		s.grow(minSketchWidth)
+	}
+	for i, j := range s.indexes(key) {
+		if s.rows[i][j] < maxCount {
+			s.rows[i][j]++
+		}
+	}
+	s.adds++
+	if s.adds >= resetFactor*len(s.rows[0]) {
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] /= 2
+			}
+		}
+		s.adds /= 2
+		s.resets++
+	}
+}
+
+func (s *sketch) estimate(key string) uint8 {
+	if s.rows[0] == nil {
+		return 0
+	}
+	est := uint8(maxCount)
+	for i, j := range s.indexes(key) {
+		if s.rows[i][j] < est {
+			est = s.rows[i][j]
+		}
+	}
+	return est
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tinylfu
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	c := New(0)
+	c.Add("myKey", 1234)
+	if val, ok := c.Get("myKey"); !ok {
+		t.Fatal("cache miss for myKey")
+	} else if val != 1234 {
+		t.Fatalf("got %v for myKey; want 1234", val)
+	}
+	if _, ok := c.Get("nonsense"); ok {
+		t.Fatal("cache hit for nonsense")
+	}
+}
+
+func TestPeek(t *testing.T) {
+	c := New(0)
+	c.Add("myKey", 1234)
+	before := c.sketch.estimate("myKey")
+	if val, ok := c.Peek("myKey"); !ok || val != 1234 {
+		t.Fatalf("Peek = %v, %v; want 1234, true", val, ok)
+	}
+	if after := c.sketch.estimate("myKey"); after != before {
+		t.Fatalf("estimate after Peek = %d; want %d", after, before)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	c := New(0)
+	c.Add("myKey", 1234)
+	c.Remove("myKey")
+	if _, ok := c.Get("myKey"); ok {
+		t.Fatal("TestRemove returned a removed entry")
+	}
+	if n := c.Len(); n != 0 {
+		t.Fatalf("Len() = %d after Remove; want 0", n)
+	}
+}
+
+func TestEvict(t *testing.T) {
+	evicted := 0
+	c := New(10)
+	c.OnEvicted = func(key string, value interface{}) { evicted++ }
+	for i := 0; i < 30; i++ {
+		c.Add(fmt.Sprintf("myKey%d", i), i)
+	}
+	if c.Len() != 10 {
+		t.Fatalf("Len() = %d; want 10", c.Len())
+	}
+	if evicted != 20 {
+		t.Fatalf("evicted %d entries; want 20", evicted)
+	}
+}
+
+func TestScanResistance(t *testing.T) {
+	c := New(100)
+	hot := func(i int) string { return fmt.Sprintf("hot%d", i) }
+	use := func(key string) {
+		if _, ok := c.Get(key); !ok {
+			c.Add(key, key)
+		}
+	}
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 50; i++ {
+			use(hot(i))
+		}
+	}
+	// Keep using the hot keys during a scan of keys used only once.
+	// The scan would flush them from an LRU cache of the same size,
+	// as more than 100 other keys are used between two uses of each
+	// hot key.
+	for i := 0; i < 1000; i++ {
+		use(fmt.Sprintf("cold%d", 2*i))
+		use(fmt.Sprintf("cold%d", 2*i+1))
+		use(hot(i % 50))
+	}
+	for i := 0; i < 50; i++ {
+		if _, ok := c.Get(hot(i)); !ok {
+			t.Errorf("hot key %q was evicted by the scan", hot(i))
+		}
+	}
+	if s := c.Stats(); s.Rejected == 0 {
+		t.Errorf("Stats() = %+v; want rejected admissions", s)
+	}
+}
+
+func TestSketchReset(t *testing.T) {
+	c := New(0)
+	for i := 0; i < 10*minSketchWidth; i++ {
+		c.Get("myKey")
+	}
+	if s := c.Stats(); s.Resets != 1 {
+		t.Fatalf("Stats().Resets = %d; want 1", s.Resets)
+	}
+	if est := c.sketch.estimate("myKey"); est > maxCount/2+1 {
+		t.Fatalf("estimate after reset = %d; want at most %d", est, maxCount/2+1)
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2026 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// trace.go lets a Tracer time the steps of a Get, and carries traces
+// between peers in W3C traceparent headers.
+
+package groupcache
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// A Tracer starts the spans that time the steps of a Get, so that a
+// slow Get shows whether its time went to waiting for a concurrent
+// load, to a peer or to the Getter. The spans are named:
+//
+//	groupcache.Get            the whole Get, here or for a peer
+//	groupcache.lookupCache    the lookup of the key in the caches
+//	groupcache.loadGroup      the load of a missing key, including
+//	                          the wait for a concurrent load of it
+//	groupcache.getFromPeer    a request to a peer
+//	groupcache.getLocally     a call to the Getter
+//	groupcache.populateCache  the addition of a value to a cache
+//
+// Implementations typically adapt a tracing library. The parent of a
+// span started for a peer's request is given by SpanContextFromContext.
+type Tracer interface {
+	// Start starts a span named name as a child of the span of ctx,
+	// if any. It returns the span and a context carrying it.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// A Span times a step of a Get.
+type Span interface {
+	// SetAttribute annotates the span, such as with the group and
+	// the key, as "groupcache.group" and "groupcache.key".
+	SetAttribute(key, value string)
+
+	// SpanContext returns the identity of the span, which is sent
+	// to peers as the parent of their spans. It may return the
+	// zero SpanContext to send none.
+	SpanContext() SpanContext
+
+	// End ends the span. err is the error of the step, if any.
+	End(err error)
+}
+
+// nopSpan is the Span of groups without a Tracer.
+type nopSpan struct{}
+
+func (nopSpan) SetAttribute(key, value string) {}
+func (nopSpan) SpanContext() SpanContext       { return SpanContext{} }
+func (nopSpan) End(err error)                  {}
+
+// startSpan starts a span named "groupcache."+name for key with the
+// group's Tracer, if any.
+func (g *Group) startSpan(ctx context.Context, name, key string) (context.Context, Span) {
+	if g.opts.Tracer == nil {
+		return ctx, nopSpan{}
+	}
+	ctx, span := g.opts.Tracer.Start(ctx, "groupcache."+name)
+	span.SetAttribute("groupcache.group", g.name)
+	span.SetAttribute("groupcache.key", key)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// A SpanContext identifies a span across processes, as in a W3C
+// traceparent header.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte // the trace flags, such as 1 if the trace is sampled
+}
+
+// IsValid reports whether sc has both a trace ID and a span ID.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent returns sc formatted as a traceparent header.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%x-%x-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// traceparentHeader is the W3C Trace Context header of HTTP requests
+// to peers.
+const traceparentHeader = "Traceparent"
+
+// traceparentLen is the length of a version 00 traceparent header.
+const traceparentLen = len("00-") + 32 + len("-") + 16 + len("-") + 2
+
+var errTraceparent = errors.New("groupcache: malformed traceparent")
+
+// ParseTraceparent parses a W3C traceparent header. It accepts the
+// fields of versions after 00 that it knows, and ignores the rest.
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	if len(s) < traceparentLen || len(s) > traceparentLen && (s[:2] == "00" || s[traceparentLen] != '-') {
+		return sc, errTraceparent
+	}
+	if s[2] != '-' || s[35] != '-' || s[52] != '-' || s[:2] == "ff" {
+		return sc, errTraceparent
+	}
+	var version, flags [1]byte
+	if !decodeHex(version[:], s[:2]) ||
+		!decodeHex(sc.TraceID[:], s[3:35]) ||
+		!decodeHex(sc.SpanID[:], s[36:52]) ||
+		!decodeHex(flags[:], s[53:55]) {
+		return SpanContext{}, errTraceparent
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return SpanContext{}, errTraceparent
+	}
+	return sc, nil
+}
+
+// decodeHex decodes the lowercase hex s into dst, which is exactly
+// long enough.
+func decodeHex(dst []byte, s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	n, err := hex.Decode(dst, []byte(s))
+	return err == nil && n == len(dst)
+}
+
+type spanKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx in which sc is the
+// parent of the spans started from it. HTTPPool uses it for the
+// traceparent header of peers' requests.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanKey{}, sc)
+}
+
+// SpanContextFromContext returns the SpanContext of the innermost span
+// that a group's Tracer started in ctx, or else the one that
+// ContextWithSpanContext set. It returns the zero SpanContext if there
+// is neither.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	switch v := ctx.Value(spanKey{}).(type) {
+	case Span:
+		return v.SpanContext()
+	case SpanContext:
+		return v
+	}
+	return SpanContext{}
+}